@@ -1,13 +1,18 @@
 module github.com/sigma/vgo-k8s-tools
 
+go 1.27.1
+
 require (
 	github.com/bgentry/go-netrc v0.0.0-20140422174119-9fd32a8b3d3d
 	github.com/birkelund/boltdbcache v0.0.0-20171002130706-d9be082dca00
 	github.com/blang/semver v3.5.1+incompatible
-	github.com/coreos/bbolt v1.3.0 // indirect
 	github.com/google/go-github v17.0.0+incompatible
-	github.com/google/go-querystring v0.0.0-20170111101155-53e6ce116135 // indirect
 	github.com/gregjones/httpcache v0.0.0-20180305231024-9cad4c3443a7
-	golang.org/x/net v0.0.0-20180906233101-161cd47e91fd // indirect
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 )
+
+require (
+	github.com/coreos/bbolt v1.3.0 // indirect
+	github.com/google/go-querystring v0.0.0-20170111101155-53e6ce116135 // indirect
+	golang.org/x/net v0.0.0-20180906233101-161cd47e91fd // indirect
+)
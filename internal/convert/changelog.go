@@ -0,0 +1,299 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sigma/vgo-k8s-tools/internal/github"
+)
+
+// RepoChange describes how the revision of a repository changed between two
+// Godeps documents. Old fields are empty for added repositories, New ones for
+// removed repositories.
+type RepoChange struct {
+	Repo   string
+	OldRev string `json:",omitempty"`
+	OldTag string `json:",omitempty"`
+	NewRev string `json:",omitempty"`
+	NewTag string `json:",omitempty"`
+	// CompareURL links to the Github comparison of both revisions, when
+	// available
+	CompareURL string `json:",omitempty"`
+}
+
+// Changelog lists the repositories that changed between two Godeps documents
+type Changelog struct {
+	Added   []*RepoChange
+	Removed []*RepoChange
+	Changed []*RepoChange
+}
+
+type repoRev struct {
+	rev string
+	tag string
+}
+
+// godepsRepos groups the dependencies of gd by repository
+func godepsRepos(gd *Godeps) map[string]repoRev {
+	res := make(map[string]repoRev)
+	for _, d := range gd.Deps {
+		r, _, err := GuessRepo(d.ImportPath)
+		if err != nil {
+			// keep unknown packages as their own repository
+			r = d.ImportPath
+		}
+		if _, ok := res[r]; !ok {
+			res[r] = repoRev{d.Rev, d.Comment}
+		}
+	}
+	return res
+}
+
+// NewChangelog computes the changes from old to new, sorted by repository
+func NewChangelog(old, new *Godeps) *Changelog {
+	oldRepos := godepsRepos(old)
+	newRepos := godepsRepos(new)
+
+	cl := &Changelog{}
+	for r, o := range oldRepos {
+		n, ok := newRepos[r]
+		if !ok {
+			cl.Removed = append(cl.Removed, &RepoChange{
+				Repo:   r,
+				OldRev: o.rev,
+				OldTag: o.tag,
+			})
+			continue
+		}
+		if n.rev == o.rev && n.tag == o.tag {
+			continue
+		}
+		c := &RepoChange{
+			Repo:   r,
+			OldRev: o.rev,
+			OldTag: o.tag,
+			NewRev: n.rev,
+			NewTag: n.tag,
+		}
+		if o.rev != LocalHash && n.rev != LocalHash && o.rev != n.rev {
+			c.CompareURL, _ = github.CompareURL(r, o.rev, n.rev)
+		}
+		cl.Changed = append(cl.Changed, c)
+	}
+	for r, n := range newRepos {
+		if _, ok := oldRepos[r]; !ok {
+			cl.Added = append(cl.Added, &RepoChange{
+				Repo:   r,
+				NewRev: n.rev,
+				NewTag: n.tag,
+			})
+		}
+	}
+
+	for _, l := range [][]*RepoChange{cl.Added, cl.Removed, cl.Changed} {
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].Repo < l[j].Repo
+		})
+	}
+	return cl
+}
+
+// Empty tells whether nothing changed
+func (cl *Changelog) Empty() bool {
+	return len(cl.Added)+len(cl.Removed)+len(cl.Changed) == 0
+}
+
+// describeRev formats a revision along with its tag, if any
+func describeRev(rev, tag string) string {
+	if rev == LocalHash {
+		rev = "local"
+	} else if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if tag == "" {
+		return rev
+	}
+	return fmt.Sprintf("%s (%s)", tag, rev)
+}
+
+func (c *RepoChange) oldRev() string {
+	return describeRev(c.OldRev, c.OldTag)
+}
+
+func (c *RepoChange) newRev() string {
+	return describeRev(c.NewRev, c.NewTag)
+}
+
+// Text writes the changelog as plain text
+func (cl *Changelog) Text(w io.Writer) {
+	if cl.Empty() {
+		fmt.Fprintln(w, "No dependency changes.")
+		return
+	}
+	if len(cl.Added) > 0 {
+		fmt.Fprintln(w, "Added:")
+		for _, c := range cl.Added {
+			fmt.Fprintf(w, "  %s %s\n", c.Repo, c.newRev())
+		}
+	}
+	if len(cl.Removed) > 0 {
+		fmt.Fprintln(w, "Removed:")
+		for _, c := range cl.Removed {
+			fmt.Fprintf(w, "  %s %s\n", c.Repo, c.oldRev())
+		}
+	}
+	if len(cl.Changed) > 0 {
+		fmt.Fprintln(w, "Changed:")
+		for _, c := range cl.Changed {
+			fmt.Fprintf(w, "  %s %s -> %s\n", c.Repo, c.oldRev(), c.newRev())
+			if c.CompareURL != "" {
+				fmt.Fprintf(w, "    %s\n", c.CompareURL)
+			}
+		}
+	}
+}
+
+// Markdown writes the changelog as Markdown, for pull request descriptions
+func (cl *Changelog) Markdown(w io.Writer) {
+	if cl.Empty() {
+		fmt.Fprintln(w, "No dependency changes.")
+		return
+	}
+	sep := ""
+	if len(cl.Added) > 0 {
+		fmt.Fprint(w, sep+"### Added\n\n")
+		for _, c := range cl.Added {
+			fmt.Fprintf(w, "- `%s`: %s\n", c.Repo, c.newRev())
+		}
+		sep = "\n"
+	}
+	if len(cl.Removed) > 0 {
+		fmt.Fprint(w, sep+"### Removed\n\n")
+		for _, c := range cl.Removed {
+			fmt.Fprintf(w, "- `%s`: %s\n", c.Repo, c.oldRev())
+		}
+		sep = "\n"
+	}
+	if len(cl.Changed) > 0 {
+		fmt.Fprint(w, sep+"### Changed\n\n")
+		for _, c := range cl.Changed {
+			fmt.Fprintf(w, "- `%s`: %s → %s", c.Repo, c.oldRev(), c.newRev())
+			if c.CompareURL != "" {
+				fmt.Fprintf(w, " ([compare](%s))", c.CompareURL)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// loadGodepsFile loads the Godeps document in fname, which must exist
+func loadGodepsFile(fname string) (*Godeps, error) {
+	gd, err := LoadGodeps(fname)
+	if err == nil && gd == nil {
+		err = fmt.Errorf("%s: no such file", fname)
+	}
+	return gd, err
+}
+
+// loadGodepsRef loads a Godeps document from a file if ref names one,
+// relative paths being relative to dir, or from git otherwise: ref is then
+// either REV:PATH, or a revision whose file at path (relative to the root of
+// the repository in dir) is loaded
+func loadGodepsRef(ctx context.Context, dir, path, ref string) (*Godeps, error) {
+	fname := ref
+	if !filepath.IsAbs(fname) {
+		fname = filepath.Join(dir, fname)
+	}
+	if _, err := os.Stat(fname); err == nil {
+		return loadGodepsFile(fname)
+	}
+
+	if !strings.Contains(ref, ":") {
+		ref = ref + ":" + path
+	}
+	cmd := exec.CommandContext(ctx, "git", "show", ref)
+	cmd.Dir = dir
+	content, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, fmt.Errorf("git show %s: %v", ref, err)
+	}
+
+	gd := &Godeps{}
+	err = json.Unmarshal(content, gd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ref, err)
+	}
+	return gd, nil
+}
+
+func changelogMain(args []string) {
+	cwd, _ := os.Getwd()
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" changelog", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] <old> [<new>]\n\n", fs.Name())
+		fmt.Fprintln(fs.Output(), "<old> and <new> are Godeps.json files, relative to -root, or git revisions. <new> defaults to the working tree.")
+		fs.PrintDefaults()
+	}
+	root := fs.String("root", cwd, "root directory of the main module")
+	file := fs.String("file", filepath.Join("Godeps", "Godeps.json"), "Godeps.json file to compare, relative to -root")
+	format := fs.String("format", "text", "output format: \"text\", \"markdown\" or \"json\"")
+	timeout := fs.Duration("timeout", 0, "maximum duration of the whole run (0 for no limit)")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		usageError(fs, "expected one or two revisions")
+	}
+	switch *format {
+	case "text", "markdown", "json":
+	default:
+		usageError(fs, "unknown format: "+*format)
+	}
+
+	dir := absRoot(*root)
+	ctx, cancel := runContext(*timeout)
+	defer cancel()
+
+	// git wants paths relative to the root of the repository
+	top, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "git rev-parse:", err)
+		os.Exit(1)
+	}
+	path := filepath.ToSlash(filepath.Join(strings.TrimSpace(string(top)), *file))
+
+	docs := make([]*Godeps, 2)
+	for i := range docs {
+		if i < fs.NArg() {
+			docs[i], err = loadGodepsRef(ctx, dir, path, fs.Arg(i))
+		} else {
+			docs[i], err = loadGodepsFile(filepath.Join(dir, *file))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	cl := NewChangelog(docs[0], docs[1])
+	switch *format {
+	case "text":
+		cl.Text(os.Stdout)
+	case "markdown":
+		cl.Markdown(os.Stdout)
+	case "json":
+		js, _ := json.MarshalIndent(cl, "", "\t")
+		fmt.Println(string(js))
+	}
+}
@@ -0,0 +1,86 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangelog(t *testing.T) {
+	old := &Godeps{
+		Deps: []Dependency{
+			{ImportPath: "github.com/foo/bar", Comment: "v1.0.0", Rev: "aaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "github.com/foo/bar/sub", Comment: "v1.0.0", Rev: "aaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "golang.org/x/net/http2", Rev: "bbbbbbbbbbbbbbbbbbbb"},
+			{ImportPath: "k8s.io/api/core/v1", Rev: LocalHash},
+			{ImportPath: "gopkg.in/yaml.v2", Rev: "cccccccccccccccccccc"},
+		},
+	}
+	new := &Godeps{
+		Deps: []Dependency{
+			{ImportPath: "github.com/foo/bar/sub", Comment: "v1.1.0", Rev: "dddddddddddddddddddd"},
+			{ImportPath: "golang.org/x/net/http2", Rev: "bbbbbbbbbbbbbbbbbbbb"},
+			{ImportPath: "k8s.io/api/core/v1", Rev: "eeeeeeeeeeeeeeeeeeee"},
+			{ImportPath: "github.com/baz/qux", Rev: "ffffffffffffffffffff"},
+		},
+	}
+
+	cl := NewChangelog(old, new)
+
+	var text bytes.Buffer
+	cl.Text(&text)
+	expected := `Added:
+  github.com/baz/qux ffffffffffff
+Removed:
+  gopkg.in/yaml.v2 cccccccccccc
+Changed:
+  github.com/foo/bar v1.0.0 (aaaaaaaaaaaa) -> v1.1.0 (dddddddddddd)
+    https://github.com/foo/bar/compare/aaaaaaaaaaaaaaaaaaaa...dddddddddddddddddddd
+  k8s.io/api local -> eeeeeeeeeeee
+`
+	if text.String() != expected {
+		t.Errorf("unexpected text changelog:\n%s", text.String())
+	}
+
+	var md bytes.Buffer
+	cl.Markdown(&md)
+	expected = "### Added\n\n" +
+		"- `github.com/baz/qux`: ffffffffffff\n\n" +
+		"### Removed\n\n" +
+		"- `gopkg.in/yaml.v2`: cccccccccccc\n\n" +
+		"### Changed\n\n" +
+		"- `github.com/foo/bar`: v1.0.0 (aaaaaaaaaaaa) → v1.1.0 (dddddddddddd) ([compare](https://github.com/foo/bar/compare/aaaaaaaaaaaaaaaaaaaa...dddddddddddddddddddd))\n" +
+		"- `k8s.io/api`: local → eeeeeeeeeeee\n"
+	if md.String() != expected {
+		t.Errorf("unexpected markdown changelog:\n%s", md.String())
+	}
+
+	if !NewChangelog(new, new).Empty() {
+		t.Error("expected no changes")
+	}
+}
+
+func TestLoadGodepsRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "changelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "old.json"), []byte(`{"ImportPath": "example.com/main"}`), 0644)
+
+	// file refs are relative to the root, not to the working directory
+	gd, err := loadGodepsRef(context.Background(), dir, "Godeps/Godeps.json", "old.json")
+	if err != nil || gd.ImportPath != "example.com/main" {
+		t.Errorf("unexpected document %v: %v", gd, err)
+	}
+
+	missing := filepath.Join(dir, "Godeps", "Godeps.json")
+	if _, err := loadGodepsFile(missing); err == nil || !strings.Contains(err.Error(), missing+": no such file") {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+}
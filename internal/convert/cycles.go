@@ -0,0 +1,94 @@
+package convert
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+// Cycles returns the import cycles of the package graph, or of the module
+// graph if modules is set. Test imports are only considered if withTests is
+// set.
+func (i *Inventory) Cycles(ctx context.Context, modules, withTests bool) ([]dependencies.Cycle, error) {
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !modules {
+		return g.Cycles(nil, withTests), nil
+	}
+	return g.Cycles(func(pkg string) string {
+		if m := i.moduleFor(g.PackagePath(pkg)); m != nil {
+			return m.Path
+		}
+		return ""
+	}, withTests), nil
+}
+
+// printCycle writes the nodes of a cycle, followed by the imports creating it
+func printCycle(w io.Writer, kind string, c dependencies.Cycle) {
+	fmt.Fprintf(w, "%s cycle: %s\n", kind, strings.Join(c.Nodes, ", "))
+	for _, e := range c.Edges {
+		if e.Test {
+			fmt.Fprintf(w, "\t%s -> %s (test)\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(w, "\t%s -> %s\n", e.From, e.To)
+		}
+	}
+}
+
+func cyclesMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" cycles", flag.ExitOnError)
+	flags := newInventoryFlags(fs, true)
+	level := fs.String("level", "all", "graph to check: module, package or all")
+	tests := fs.Bool("tests", false, "consider test imports")
+	fail := fs.Bool("fail", false, "exit with a non-zero status if cycles are found")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+	var levels []string
+	switch *level {
+	case "all":
+		levels = []string{"module", "package"}
+	case "module", "package":
+		levels = []string{*level}
+	default:
+		usageError(fs, "unknown level "+*level)
+	}
+	flags.parse()
+
+	ctx, cancel := flags.context()
+	defer cancel()
+
+	inv, err := flags.load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	found := false
+	for _, lvl := range levels {
+		log.Println("looking for", lvl, "cycles")
+		cycles, err := inv.Cycles(ctx, lvl == "module", *tests)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, c := range cycles {
+			printCycle(os.Stdout, lvl, c)
+		}
+		found = found || len(cycles) > 0
+	}
+	if found && *fail {
+		os.Exit(1)
+	}
+}
@@ -2,9 +2,7 @@ package convert
 
 import (
 	"encoding/json"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"fmt"
 	"runtime"
 	"sort"
 	"strings"
@@ -29,32 +27,65 @@ type Dependency struct {
 	Rev        string
 }
 
-func (gd *Godeps) DumpToFile(fname string) error {
+// LoadGodeps reads the Godeps document in fname. It returns nil if the file
+// doesn't exist.
+func LoadGodeps(fname string) (*Godeps, error) {
+	content, err := readExisting(fname)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	gd := &Godeps{}
+	err = json.Unmarshal(content, gd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return gd, nil
+}
+
+// Merge copies the metadata of old into gd, keeping only the dependencies of
+// gd
+func (gd *Godeps) Merge(old *Godeps) {
+	gd.GoVersion = old.GoVersion
+	gd.GodepVersion = old.GodepVersion
+	gd.Packages = append([]string(nil), old.Packages...)
+}
+
+// Render serializes the Godeps document, filling in generation metadata that
+// isn't already set. Packages default to ./... .
+func (gd *Godeps) Render() ([]byte, error) {
 	gd.Comment = "GENERATED FROM VGO, DO NOT EDIT"
-	gd.Packages = append(gd.Packages, "./...")
-	gd.GoVersion = getVersion()
-	gd.GodepVersion = GodepCompat
+	if len(gd.Packages) == 0 {
+		gd.Packages = []string{"./..."}
+	}
+	if gd.GoVersion == "" {
+		gd.GoVersion = getVersion()
+	}
+	if gd.GodepVersion == "" {
+		gd.GodepVersion = GodepCompat
+	}
 
 	sort.Slice(gd.Deps, func(i, j int) bool {
 		return strings.Compare(gd.Deps[i].ImportPath, gd.Deps[j].ImportPath) < 0
 	})
 
-	js, err := json.MarshalIndent(gd, "", "\t")
-	if err != nil {
-		return err
-	}
+	return json.MarshalIndent(gd, "", "\t")
+}
 
-	parent := filepath.Dir(fname)
-	err = os.MkdirAll(parent, 0755)
+func (gd *Godeps) DumpToFile(fname string) error {
+	js, err := gd.Render()
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(fname, js, 0644)
-	return err
+	return (&DiskOutput{}).WriteFile(fname, js)
 }
 
 func getVersion() string {
-	v := runtime.Version()
+	return shortGoVersion(runtime.Version())
+}
+
+// shortGoVersion strips the patch level of go version v, as in go1.21 for
+// go1.21.0, so that versions from go directives and toolchains look alike
+func shortGoVersion(v string) string {
 	p := strings.Split(v, ".")
 	if len(p) > 1 {
 		return p[0] + "." + p[1]
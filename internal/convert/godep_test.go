@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+func TestGodepsMeta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godeps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "Godeps.json")
+	old := &Godeps{
+		ImportPath:   "example.com/main",
+		GoVersion:    "go1.12",
+		GodepVersion: "v79",
+		Packages:     []string{"./...", "example.com/main/tool"},
+		Deps:         []Dependency{{ImportPath: "example.com/old", Rev: "aaaa"}},
+	}
+	err = old.DumpToFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := NewInventory(dir, []*Module{{Path: "example.com/main", Main: true, Dir: dir}})
+	inv.g = dependencies.Graph{"example.com/main": {}}
+	tools := filepath.Join(dir, "tools.go")
+
+	for _, tc := range []struct {
+		name     string
+		c        Converter
+		tools    string
+		goMod    string
+		expected Godeps
+	}{
+		{
+			name:     "overwrite",
+			goMod:    "module example.com/main\n",
+			expected: Godeps{GoVersion: getVersion(), GodepVersion: GodepCompat, Packages: []string{"./..."}},
+		},
+		{
+			name:     "tools",
+			tools:    "// +build tools\n\npackage main\n\nimport _ \"example.com/tool\"\n",
+			goMod:    "module example.com/main\n",
+			expected: Godeps{GoVersion: getVersion(), GodepVersion: GodepCompat, Packages: []string{"example.com/tool", "./..."}},
+		},
+		{
+			name:     "merged tools",
+			c:        Converter{MergeGodeps: true},
+			tools:    "// +build tools\n\npackage main\n\nimport _ \"example.com/tool\"\n",
+			goMod:    "module example.com/main\n",
+			expected: Godeps{GoVersion: "go1.12", GodepVersion: "v79", Packages: old.Packages},
+		},
+		{
+			name:     "merge",
+			c:        Converter{MergeGodeps: true},
+			goMod:    "module example.com/main\n",
+			expected: Godeps{GoVersion: "go1.12", GodepVersion: "v79", Packages: old.Packages},
+		},
+		{
+			name:     "go directive",
+			c:        Converter{MergeGodeps: true},
+			goMod:    "module example.com/main\n\ngo 1.13\n",
+			expected: Godeps{GoVersion: "go1.13", GodepVersion: "v79", Packages: old.Packages},
+		},
+		{
+			name:     "patch level",
+			goMod:    "module example.com/main\n\ngo 1.21.0\n",
+			expected: Godeps{GoVersion: "go1.21", GodepVersion: GodepCompat, Packages: []string{"./..."}},
+		},
+		{
+			name: "flags",
+			c: Converter{MergeGodeps: true, GodepsMeta: Godeps{
+				GoVersion:    "go1.14",
+				GodepVersion: "v80",
+				Packages:     []string{"./cmd/..."},
+			}},
+			goMod:    "module example.com/main\n\ngo 1.13\n",
+			expected: Godeps{GoVersion: "go1.14", GodepVersion: "v80", Packages: []string{"./cmd/..."}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(tools)
+			if tc.tools != "" {
+				ioutil.WriteFile(tools, []byte(tc.tools), 0644)
+			}
+			gd, err := inv.AsGodeps(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tc.c.setGodepsMeta(gd, fname, []byte(tc.goMod))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = gd.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gd.GoVersion != tc.expected.GoVersion || gd.GodepVersion != tc.expected.GodepVersion {
+				t.Errorf("unexpected versions %s, %s", gd.GoVersion, gd.GodepVersion)
+			}
+			if !reflect.DeepEqual(gd.Packages, tc.expected.Packages) {
+				t.Errorf("unexpected packages %v", gd.Packages)
+			}
+			// old dependencies are never merged
+			if len(gd.Deps) != 0 {
+				t.Errorf("unexpected deps %v", gd.Deps)
+			}
+		})
+	}
+}
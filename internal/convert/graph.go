@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+// graphFormats are the formats supported by the graph command
+var graphFormats = map[string]func(g dependencies.Graph, b *bytes.Buffer, c dependencies.Clusters) error{
+	"dot": func(g dependencies.Graph, b *bytes.Buffer, c dependencies.Clusters) error {
+		return g.WriteDOT(b, c)
+	},
+	"graphml": func(g dependencies.Graph, b *bytes.Buffer, c dependencies.Clusters) error {
+		return g.WriteGraphML(b, c)
+	},
+	"json": func(g dependencies.Graph, b *bytes.Buffer, c dependencies.Clusters) error {
+		return g.WriteJSON(b, c)
+	},
+}
+
+// Graph returns the package graph of the main module and its dependencies,
+// along with the module of each package. Staging modules are labeled as
+// such.
+func (i *Inventory) Graph(ctx context.Context) (dependencies.Graph, dependencies.Clusters, error) {
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, func(pkg string) string {
+		return i.moduleLabel(g.PackagePath(pkg))
+	}, nil
+}
+
+// moduleLabel returns the module of pkg, suffixed for staging modules
+func (i *Inventory) moduleLabel(pkg string) string {
+	m := i.moduleFor(pkg)
+	switch {
+	case m == nil:
+		return ""
+	case !m.Main && m.isLocal():
+		return m.Path + " (staging)"
+	}
+	return m.Path
+}
+
+func graphMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" graph", flag.ExitOnError)
+	flags := newInventoryFlags(fs, true)
+	format := fs.String("format", "dot", "output format: dot, graphml or json")
+	output := fs.String("o", "", "file to write the graph to (defaults to stdout)")
+	input := fs.String("input", "", "graph previously written with -format json, to convert instead of computing it")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+	write, ok := graphFormats[*format]
+	if !ok {
+		usageError(fs, "unknown format "+*format)
+	}
+	flags.parse()
+
+	var err error
+	var g dependencies.Graph
+	var clusters dependencies.Clusters
+	if *input != "" {
+		g, clusters, err = loadGraph(*input)
+	} else {
+		ctx, cancel := flags.context()
+		defer cancel()
+
+		var inv *Inventory
+		inv, err = flags.load(ctx)
+		if err == nil {
+			log.Println("computing package graph")
+			g, clusters, err = inv.Graph(ctx)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var b bytes.Buffer
+	if err := write(g, &b, clusters); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(b.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*output, b.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loadGraph reads a graph written in the JSON format
+func loadGraph(fname string) (dependencies.Graph, dependencies.Clusters, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	g, modules, err := dependencies.ReadJSON(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return g, func(pkg string) string { return modules[pkg] }, nil
+}
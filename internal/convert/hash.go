@@ -0,0 +1,259 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var pseudoVersionRE = regexp.MustCompile(`-(?:.*\.)?[0-9]{14}-([0-9a-f]{12})(?:\+incompatible)?$`)
+
+var fullHashRE = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func isPseudoVersion(v string) bool {
+	return pseudoVersionRE.MatchString(v)
+}
+
+// HashResolver finds the commit hash of modules. Modules replaced by a local
+// directory get LocalHash, or the last commit touching that directory if
+// StagingCommits is set. For other modules, it tries, in order:
+//   - the .info file of the module cache
+//   - the tag matching the version, or the revision encoded in the
+//     pseudo-version, in a local checkout
+//   - the .info file served by a module proxy
+//
+// Only full commit hashes are returned: abbreviated revisions of
+// pseudo-versions that can't be expanded are an error.
+type HashResolver struct {
+	// GoPath is where local checkouts are looked up, as GoPath/src/<repo>
+	GoPath string
+	// Proxy is the base URL of a module proxy. No proxy is queried if empty.
+	Proxy string
+	// Client is used to query the proxy. Defaults to http.DefaultClient.
+	Client *http.Client
+	// StagingCommits records the actual commit of locally replaced modules
+	// instead of a placeholder
+	StagingCommits bool
+}
+
+// NewHashResolver returns a resolver configured from the environment
+// (GOPATH and GOPROXY)
+func NewHashResolver() *HashResolver {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, _ := os.UserHomeDir()
+		gopath = filepath.Join(home, "go")
+	}
+
+	goproxy := os.Getenv("GOPROXY")
+	if goproxy == "" {
+		goproxy = "https://proxy.golang.org"
+	}
+	proxy := ""
+	for _, p := range strings.FieldsFunc(goproxy, func(r rune) bool {
+		return r == ',' || r == '|'
+	}) {
+		if p != "direct" && p != "off" {
+			proxy = p
+			break
+		}
+	}
+
+	return &HashResolver{
+		GoPath: filepath.SplitList(gopath)[0],
+		Proxy:  proxy,
+	}
+}
+
+// Resolve returns the commit hash of m
+func (h *HashResolver) Resolve(ctx context.Context, m *Module) (string, error) {
+	if m.isLocal() && h.StagingCommits {
+		return h.fromStaging(ctx, m.Replace.Dir)
+	}
+
+	hash, err := m.GetHash()
+	if err == nil {
+		return hash, nil
+	}
+	errs := []string{"module cache: " + err.Error()}
+
+	version := m.Version
+	if m.Replace.Version != "" {
+		version = m.Replace.Version
+	}
+	path := m.Path
+	if m.Replace.Path != "" {
+		path = m.Replace.Path
+	}
+
+	// pseudo-versions only carry an abbreviated hash, which a checkout or
+	// the proxy expand
+	rev := strings.TrimSuffix(version, "+incompatible")
+	if sub := pseudoVersionRE.FindStringSubmatch(version); sub != nil {
+		rev = sub[1]
+	}
+	hash, err = h.fromCheckout(ctx, path, rev)
+	if err == nil {
+		return hash, nil
+	}
+	errs = append(errs, "local checkout: "+err.Error())
+
+	if h.Proxy != "" {
+		hash, err = h.fromProxy(ctx, path, version)
+		if err == nil {
+			return hash, nil
+		}
+		errs = append(errs, "proxy: "+err.Error())
+	}
+
+	return "", fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// fromStaging returns the last commit touching dir in the repository that
+// contains it
+func (h *HashResolver) fromStaging(ctx context.Context, dir string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "log", "-1", "--format=%H", "--", ".").Output()
+	if err != nil {
+		return "", fmt.Errorf("git log in %s: %v", dir, err)
+	}
+	hash := strings.TrimSpace(string(out))
+	if hash == "" {
+		return "", fmt.Errorf("no commit touches %s", dir)
+	}
+	return hash, nil
+}
+
+// fromCheckout resolves rev (a tag or an abbreviated hash) in the local
+// checkout of the repository containing module path
+func (h *HashResolver) fromCheckout(ctx context.Context, path, rev string) (string, error) {
+	dir, sub, err := h.checkout(path)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{rev}
+	if sub != "" {
+		candidates = append(candidates, sub+"/"+rev)
+	}
+	for _, c := range candidates {
+		out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--verify", "-q", c+"^{commit}").Output()
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", rev, dir)
+}
+
+// checkout finds the local checkout of the repository containing module
+// path, and returns its directory along with the path of the module within
+// the repository
+func (h *HashResolver) checkout(path string) (string, string, error) {
+	if h.GoPath == "" {
+		return "", "", fmt.Errorf("no GOPATH")
+	}
+
+	// the repository might be rooted above the module, as for major version
+	// suffixes or modules living in a subdirectory
+	repo := path
+	for {
+		dir := filepath.Join(h.GoPath, "src", repo)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, strings.TrimPrefix(strings.TrimPrefix(path, repo), "/"), nil
+		}
+
+		i := strings.LastIndex(repo, "/")
+		if i < 0 {
+			return "", "", fmt.Errorf("no checkout of %s in %s", path, filepath.Join(h.GoPath, "src"))
+		}
+		repo = repo[:i]
+	}
+}
+
+// Describe returns the `git describe` output for revision rev of m: its
+// nearest tag, followed by the number of commits since that tag and the
+// abbreviated hash, unless rev is tagged itself. It needs a local checkout of
+// the repository. Only version tags are considered: those of modules living
+// in a subdirectory are prefixed by that directory, which is left out.
+func (h *HashResolver) Describe(ctx context.Context, m *Module, rev string) (string, error) {
+	path := m.Path
+	if m.Replace.Path != "" {
+		path = m.Replace.Path
+	}
+	dir, sub, err := h.checkout(path)
+	if err != nil {
+		return "", err
+	}
+
+	// only consider version tags of the module
+	match := "v*"
+	if sub != "" {
+		match = sub + "/v*"
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "describe", "--tags", "--match", match, rev).Output()
+	if err != nil {
+		return "", fmt.Errorf("git describe %s in %s: %v", rev, dir, err)
+	}
+	desc := strings.TrimSpace(string(out))
+	if sub != "" {
+		desc = strings.TrimPrefix(desc, sub+"/")
+	}
+	return desc, nil
+}
+
+func (h *HashResolver) fromProxy(ctx context.Context, path, version string) (string, error) {
+	url := fmt.Sprintf("%s/%s/@v/%s.info", strings.TrimSuffix(h.Proxy, "/"), escapePath(path), escapePath(version))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var info ModInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return "", err
+	}
+	if !fullHashRE.MatchString(info.hash()) {
+		return "", fmt.Errorf("%s: no full commit hash", url)
+	}
+	return info.hash(), nil
+}
+
+// UnresolvedModulesError lists modules whose commit hash couldn't be found
+type UnresolvedModulesError struct {
+	Errors map[string]error
+}
+
+func (e *UnresolvedModulesError) Error() string {
+	mods := make([]string, 0, len(e.Errors))
+	for m := range e.Errors {
+		mods = append(mods, m)
+	}
+	sort.Strings(mods)
+
+	lines := []string{fmt.Sprintf("could not resolve the revision of %d module(s):", len(mods))}
+	for _, m := range mods {
+		lines = append(lines, fmt.Sprintf("\t%s: %v", m, e.Errors[m]))
+	}
+	return strings.Join(lines, "\n")
+}
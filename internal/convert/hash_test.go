@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withOrigin := filepath.Join(dir, "v1.0.0.mod")
+	ioutil.WriteFile(filepath.Join(dir, "v1.0.0.info"), []byte(`{"Version":"v1.0.0","Origin":{"VCS":"git","Hash":"0123456789abcdef0123456789abcdef01234567"}}`), 0644)
+
+	const full = "161cd47e91fd0123456789abcdef0123456789ab"
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/b/@v/v0.0.0-20180906233101-161cd47e91fd.info":
+			fmt.Fprintf(w, `{"Version":"v0.0.0-20180906233101-161cd47e91fd","Origin":{"VCS":"git","Hash":"%s"}}`, full)
+		case "/example.com/c/@v/v1.2.4-0.20180906233101-161cd47e91fd+incompatible.info":
+			fmt.Fprintf(w, `{"Version":"v1.2.4-0.20180906233101-161cd47e91fd+incompatible","Name":"%s"}`, full)
+		case "/example.com/d/@v/v1.2.3-pre.0.20180906233101-161cd47e91fd.info":
+			fmt.Fprintf(w, `{"Version":"v1.2.3-pre.0.20180906233101-161cd47e91fd","Name":"%s"}`, full)
+		case "/example.com/f/@v/v0.0.0-20180906233101-161cd47e91fd.info":
+			fmt.Fprint(w, `{"Version":"v0.0.0-20180906233101-161cd47e91fd","Name":"161cd47e91fd"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer proxy.Close()
+
+	h := &HashResolver{Proxy: proxy.URL}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		m    *Module
+		hash string
+	}{
+		{&Module{Path: "example.com/a", Version: "v1.0.0", GoMod: withOrigin}, "0123456789abcdef0123456789abcdef01234567"},
+		{&Module{Path: "example.com/b", Version: "v0.0.0-20180906233101-161cd47e91fd"}, full},
+		{&Module{Path: "example.com/c", Version: "v1.2.4-0.20180906233101-161cd47e91fd+incompatible"}, full},
+		{&Module{Path: "example.com/d", Version: "v1.2.3-pre.0.20180906233101-161cd47e91fd"}, full},
+	} {
+		hash, err := h.Resolve(ctx, tc.m)
+		if err != nil {
+			t.Errorf("%s: %v", tc.m.Path, err)
+			continue
+		}
+		if hash != tc.hash {
+			t.Errorf("%s: expected %s, got %s", tc.m.Path, tc.hash, hash)
+		}
+	}
+
+	for _, m := range []*Module{
+		{Path: "example.com/e", Version: "v1.0.0"},
+		// the proxy only knows the abbreviated revision
+		{Path: "example.com/f", Version: "v0.0.0-20180906233101-161cd47e91fd"},
+		// nothing expands the abbreviated revision
+		{Path: "example.com/g", Version: "v0.0.0-20180906233101-161cd47e91fd"},
+	} {
+		if hash, err := h.Resolve(ctx, m); err == nil {
+			t.Errorf("%s: expected an error, got %s", m.Path, hash)
+		}
+	}
+}
+
+func TestHashResolverDescribe(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "describe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+
+	repo := filepath.Join(gopath, "src", "example.com", "repo")
+	os.MkdirAll(repo, 0755)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	git("tag", "v1.0.0")
+	git("tag", "sub/v0.1.0")
+	tagged := git("rev-parse", "HEAD")
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	git("commit", "-q", "--allow-empty", "-m", "third")
+	head := git("rev-parse", "HEAD")
+
+	h := &HashResolver{GoPath: gopath}
+	ctx := context.Background()
+	for _, tc := range []struct {
+		path     string
+		rev      string
+		expected string
+	}{
+		{"example.com/repo", tagged, "v1.0.0"},
+		{"example.com/repo", head, "v1.0.0-2-g" + head[:7]},
+		{"example.com/repo/sub", head, "v0.1.0-2-g" + head[:7]},
+	} {
+		desc, err := h.Describe(ctx, &Module{Path: tc.path}, tc.rev)
+		if err != nil {
+			t.Errorf("%s@%s: %v", tc.path, tc.rev, err)
+			continue
+		}
+		if !strings.HasPrefix(desc, tc.expected) {
+			t.Errorf("%s@%s: expected %s, got %s", tc.path, tc.rev, tc.expected, desc)
+		}
+	}
+
+	if _, err := h.Describe(ctx, &Module{Path: "example.com/other"}, head); err == nil {
+		t.Error("expected an error without checkout")
+	}
+}
@@ -0,0 +1,289 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+// describeRE matches `git describe` output, as found in Godeps comments
+var describeRE = regexp.MustCompile(`^(v[0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.-]+)?)-[0-9]+-g[0-9a-f]+$`)
+
+// CommitDater finds the commit date of a revision of a repository
+type CommitDater interface {
+	CommitTime(ctx context.Context, repo, rev string) (time.Time, error)
+}
+
+// GodepsImporter converts Godeps documents into go.mod files, the reverse of
+// Inventory.AsGodeps. Each revision is turned into a module version by trying,
+// in order:
+//   - the release tag recorded in the dependency comment
+//   - the version a module proxy reports for that revision
+//   - a pseudo-version computed from the commit date given by Dater
+type GodepsImporter struct {
+	// Proxy is the base URL of a module proxy. No proxy is queried if empty.
+	Proxy string
+	// Client is used to query the proxy. Defaults to http.DefaultClient.
+	Client *http.Client
+	// Dater finds commit dates to build pseudo-versions
+	Dater CommitDater
+	// Local lists the paths of the modules replaced by a local directory,
+	// such as staging modules. Their dependencies are skipped whatever
+	// their revision: Godeps files generated with staging commits record
+	// actual commits of the main repository for them.
+	Local []string
+
+	mu sync.Mutex
+	// versions caches the versions resolved for each revision and comment,
+	// as pseudo-versions depend on the tag they follow
+	versions map[string]string
+}
+
+// isLocal tells whether pkg belongs to one of the Local modules
+func (im *GodepsImporter) isLocal(pkg string) bool {
+	for _, l := range im.Local {
+		if pkg == l || strings.HasPrefix(pkg, l+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Requirements groups the dependencies of gd by module, and resolves the
+// version of each module
+func (im *GodepsImporter) Requirements(ctx context.Context, gd *Godeps) ([]*Module, error) {
+	type repoDep struct {
+		rev     string
+		comment string
+	}
+
+	repos := make(map[string]repoDep)
+	failed := make(map[string]error)
+	for _, d := range gd.Deps {
+		if d.Rev == LocalHash || im.isLocal(d.ImportPath) {
+			continue
+		}
+		r, _, err := GuessRepo(d.ImportPath)
+		if err != nil {
+			failed[d.ImportPath] = err
+			continue
+		}
+		if prev, ok := repos[r]; ok {
+			if prev.rev != d.Rev {
+				failed[r] = fmt.Errorf("conflicting revisions %s and %s", prev.rev, d.Rev)
+			}
+			continue
+		}
+		repos[r] = repoDep{d.Rev, d.Comment}
+	}
+
+	res := make([]*Module, 0, len(repos))
+	for r, d := range repos {
+		if _, ok := failed[r]; ok {
+			continue
+		}
+		v, err := im.resolveVersion(ctx, r, d.rev, d.comment)
+		if err != nil {
+			failed[r] = err
+			continue
+		}
+		res = append(res, &Module{
+			Path:    r,
+			Version: v,
+		})
+	}
+
+	if len(failed) > 0 {
+		return nil, &UnresolvedModulesError{
+			Errors: failed,
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+// Import renders the go.mod file equivalent to gd
+func (im *GodepsImporter) Import(ctx context.Context, gd *Godeps) ([]byte, error) {
+	reqs, err := im.Requirements(ctx, gd)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "module %s\n", gd.ImportPath)
+	if len(reqs) > 0 {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "require (")
+		for _, m := range reqs {
+			fmt.Fprintf(&b, "\t%s %s\n", m.Path, m.Version)
+		}
+		fmt.Fprintln(&b, ")")
+	}
+	return b.Bytes(), nil
+}
+
+func (im *GodepsImporter) resolveVersion(ctx context.Context, repo, rev, comment string) (string, error) {
+	if v, ok := tagVersion(repo, comment); ok {
+		return v, nil
+	}
+
+	key := repo + "@" + rev + " " + comment
+	im.mu.Lock()
+	v, ok := im.versions[key]
+	im.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	v, err := im.resolveRev(ctx, repo, rev, comment)
+	if err != nil {
+		return "", err
+	}
+	im.mu.Lock()
+	if im.versions == nil {
+		im.versions = make(map[string]string)
+	}
+	im.versions[key] = v
+	im.mu.Unlock()
+	return v, nil
+}
+
+// resolveRev turns an untagged revision into a module version
+func (im *GodepsImporter) resolveRev(ctx context.Context, repo, rev, comment string) (string, error) {
+
+	errs := make([]string, 0)
+	if im.Proxy != "" {
+		v, err := im.fromProxy(ctx, repo, rev)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, "proxy: "+err.Error())
+	}
+
+	if im.Dater != nil {
+		t, err := im.Dater.CommitTime(ctx, repo, rev)
+		if err == nil {
+			return PseudoVersion(repo, comment, t, rev), nil
+		}
+		errs = append(errs, "commit date: "+err.Error())
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("no way to resolve revision %s", rev)
+	}
+	return "", fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+func (im *GodepsImporter) fromProxy(ctx context.Context, repo, rev string) (string, error) {
+	url := fmt.Sprintf("%s/%s/@v/%s.info", strings.TrimSuffix(im.Proxy, "/"), escapePath(repo), rev)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := im.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	var info ModInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	if err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// majorVersion returns the major version implied by the repository path,
+// which is only ever non-zero for gopkg.in
+func majorVersion(repo string) int {
+	if !strings.HasPrefix(repo, "gopkg.in/") {
+		return 0
+	}
+	i := strings.LastIndex(repo, ".v")
+	if i < 0 {
+		return 0
+	}
+	maj, err := strconv.Atoi(repo[i+2:])
+	if err != nil {
+		return 0
+	}
+	return maj
+}
+
+// tagVersion returns the module version matching a release tag of repo. The
+// tag may already carry the +incompatible suffix.
+func tagVersion(repo, tag string) (string, bool) {
+	tag = strings.TrimSuffix(tag, "+incompatible")
+	if !strings.HasPrefix(tag, "v") || describeRE.MatchString(tag) {
+		return "", false
+	}
+	v, err := semver.Parse(tag[1:])
+	if err != nil || len(v.Build) > 0 || isPseudoVersion(tag) {
+		return "", false
+	}
+
+	maj := majorVersion(repo)
+	if strings.HasPrefix(repo, "gopkg.in/") {
+		if int(v.Major) != maj {
+			return "", false
+		}
+		return tag, true
+	}
+	if v.Major >= 2 {
+		return tag + "+incompatible", true
+	}
+	return tag, true
+}
+
+// PseudoVersion builds the pseudo-version of revision rev of repo, committed
+// at t. comment is the tag description found in Godeps, if any: pseudo-versions
+// of commits following a tag sort right after that tag.
+func PseudoVersion(repo, comment string, t time.Time, rev string) string {
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	ts := t.UTC().Format("20060102150405")
+
+	if m := describeRE.FindStringSubmatch(comment); m != nil {
+		if base, ok := tagVersion(repo, m[1]); ok {
+			incompatible := strings.HasSuffix(base, "+incompatible")
+			v, _ := semver.Parse(strings.TrimSuffix(base, "+incompatible")[1:])
+			var pv string
+			if len(v.Pre) > 0 {
+				pv = fmt.Sprintf("v%s.0.%s-%s", v.String(), ts, rev)
+			} else {
+				v.Patch++
+				pv = fmt.Sprintf("v%s-0.%s-%s", v.String(), ts, rev)
+			}
+			if incompatible {
+				pv += "+incompatible"
+			}
+			return pv
+		}
+	}
+
+	return fmt.Sprintf("v%d.0.0-%s-%s", majorVersion(repo), ts, rev)
+}
@@ -0,0 +1,168 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+type fakeDater map[string]time.Time
+
+func (d fakeDater) CommitTime(ctx context.Context, repo, rev string) (time.Time, error) {
+	t, ok := d[rev[:12]]
+	if !ok {
+		return t, fmt.Errorf("unknown revision %s", rev)
+	}
+	return t, nil
+}
+
+func TestGodepsImport(t *testing.T) {
+	gd := &Godeps{
+		ImportPath: "example.com/main",
+		Deps: []Dependency{
+			{ImportPath: "github.com/foo/bar", Comment: "v1.2.0", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "github.com/foo/bar/sub", Comment: "v1.2.0", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "github.com/foo/baz", Comment: "v1.0.0-3-gbbbbbbb", Rev: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+			{ImportPath: "github.com/foo/qux", Rev: "cccccccccccccccccccccccccccccccccccccccc"},
+			{ImportPath: "github.com/foo/old", Comment: "v3.5.1+incompatible", Rev: "dddddddddddddddddddddddddddddddddddddddd"},
+			{ImportPath: "gopkg.in/yaml.v2", Comment: "v2.2.1", Rev: "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"},
+			{ImportPath: "k8s.io/api/core", Comment: "v0.0.0", Rev: LocalHash},
+		},
+	}
+
+	ts := time.Date(2018, 9, 6, 23, 31, 1, 0, time.UTC)
+	im := &GodepsImporter{
+		Dater: fakeDater{
+			"bbbbbbbbbbbb": ts,
+			"cccccccccccc": ts,
+		},
+	}
+
+	content, err := im.Import(context.Background(), gd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `module example.com/main
+
+require (
+	github.com/foo/bar v1.2.0
+	github.com/foo/baz v1.0.1-0.20180906233101-bbbbbbbbbbbb
+	github.com/foo/old v3.5.1+incompatible
+	github.com/foo/qux v0.0.0-20180906233101-cccccccccccc
+	gopkg.in/yaml.v2 v2.2.1
+)
+`
+	if string(content) != expected {
+		t.Errorf("unexpected go.mod:\n%s", content)
+	}
+}
+
+func TestGodepsImportUnresolved(t *testing.T) {
+	gd := &Godeps{
+		ImportPath: "example.com/main",
+		Deps: []Dependency{
+			{ImportPath: "github.com/foo/bar", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "github.com/foo/bar/sub", Rev: "ffffffffffffffffffffffffffffffffffffffff"},
+			{ImportPath: "unknown.host/foo", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		},
+	}
+
+	_, err := (&GodepsImporter{}).Requirements(context.Background(), gd)
+	uerr, ok := err.(*UnresolvedModulesError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(uerr.Errors) != 2 {
+		t.Errorf("unexpected unresolved modules: %v", uerr)
+	}
+}
+
+// TestGodepsRoundTrip checks that importing the output of AsGodeps gives back
+// the original module versions. Staging modules record their actual commit.
+func TestGodepsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roundtrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	staging := filepath.Join(dir, "staging", "src", "k8s.io", "api")
+	os.MkdirAll(filepath.Join(staging, "core"), 0755)
+	ioutil.WriteFile(filepath.Join(staging, "core", "core.go"), []byte("package core\n"), 0644)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"commit", "-q", "-m", "staging"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	info := func(name, hash string) string {
+		ioutil.WriteFile(filepath.Join(dir, name+".info"), []byte(`{"Origin":{"Hash":"`+hash+`"}}`), 0644)
+		return filepath.Join(dir, name+".mod")
+	}
+
+	mods := []*Module{
+		{Path: "example.com/main", Main: true, Dir: dir},
+		{Path: "github.com/foo/bar", Version: "v1.2.0", GoMod: info("bar", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")},
+		{Path: "github.com/foo/baz", Version: "v0.0.0-20180906233101-bbbbbbbbbbbb", GoMod: info("baz", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")},
+		{Path: "gopkg.in/yaml.v2", Version: "v2.2.1", GoMod: info("yaml", "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")},
+		{Path: "k8s.io/api", Version: "v0.0.0", Replace: Replacement{Path: "./staging/src/k8s.io/api", Dir: staging}},
+	}
+	inv := NewInventory(dir, mods)
+	inv.Resolver = &HashResolver{StagingCommits: true}
+	inv.g = dependencies.Graph{
+		"example.com/main":       {Imports: []string{"github.com/foo/bar", "github.com/foo/baz", "gopkg.in/yaml.v2", "k8s.io/api/core"}},
+		"k8s.io/api/core":        {},
+		"github.com/foo/bar":     {Imports: []string{"github.com/foo/bar/sub"}},
+		"github.com/foo/bar/sub": {},
+		"github.com/foo/baz":     {},
+		"gopkg.in/yaml.v2":       {},
+	}
+
+	ctx := context.Background()
+	gd, err := inv.AsGodeps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staged := false
+	for _, d := range gd.Deps {
+		staged = staged || (d.ImportPath == "k8s.io/api/core" && d.Rev != LocalHash)
+	}
+	if !staged {
+		t.Fatalf("expected a staging commit in %v", gd.Deps)
+	}
+
+	im := &GodepsImporter{
+		Dater: fakeDater{
+			"bbbbbbbbbbbb": time.Date(2018, 9, 6, 23, 31, 1, 0, time.UTC),
+		},
+		Local: []string{"k8s.io/api"},
+	}
+	reqs, err := im.Requirements(ctx, gd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the main module nor staging modules are required
+	if len(reqs) != len(mods)-2 {
+		t.Fatalf("unexpected requirements: %v", reqs)
+	}
+	for _, r := range reqs {
+		if m := inv.GetModule(r.Path); m == nil || m.Version != r.Version {
+			t.Errorf("%s: expected %v, got %s", r.Path, m, r.Version)
+		}
+	}
+}
@@ -1,26 +1,172 @@
 package convert
 
 import (
+	"context"
+	"fmt"
 	"go/parser"
 	"go/token"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
 )
 
 type Inventory struct {
 	inv     map[string]*Module
-	g       dependencies.Graph
 	RootDir string
+	// Resolver finds commit hashes of modules. Defaults to NewHashResolver().
+	Resolver *HashResolver
+	// Scan selects the files whose imports make up the dependency graph
+	Scan dependencies.ScanOptions
+
+	// g is computed lazily, and shared between inventory views
+	gmu sync.Mutex
+	g   dependencies.Graph
+
+	// logger defaults to the standard logger
+	logger *log.Logger
+}
+
+func (i *Inventory) log() *log.Logger {
+	if i.logger != nil {
+		return i.logger
+	}
+	return log.New(log.Writer(), log.Prefix(), log.Flags())
 }
 
 func (i *Inventory) GetModule(mod string) *Module {
 	return i.inv[mod]
 }
 
+// Submodule returns a view of the inventory as seen from submodule mod. The
+// view shares the dependency graph of the main module, which is computed if
+// needed.
+func (i *Inventory) Submodule(ctx context.Context, mod string) (*Inventory, error) {
+	sub := i.GetModule(mod)
+	if sub == nil {
+		return nil, fmt.Errorf("unknown submodule %s", mod)
+	}
+
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := make(map[string]*Module)
+	for p, m := range i.inv {
+		if !m.Main {
+			inv[p] = m
+		}
+	}
+	main := &Module{
+		Path:  sub.Path,
+		Main:  true,
+		Dir:   sub.Dir,
+		GoMod: filepath.Join(sub.Dir, "go.mod"),
+	}
+	inv[mod] = main
+
+	return &Inventory{
+		inv:      inv,
+		g:        g,
+		RootDir:  sub.Dir,
+		Resolver: i.Resolver,
+		Scan:     i.Scan,
+		logger:   i.logger,
+	}, nil
+}
+
+// Overlay returns a copy of the inventory where modules that differ in other
+// are replaced by their version from other. Packages of those modules are
+// scanned again, the rest of the dependency graph is shared. Changed modules
+// must have a source directory.
+func (i *Inventory) Overlay(ctx context.Context, other *Inventory) (*Inventory, error) {
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := make(map[string]*Module)
+	for p, m := range i.inv {
+		inv[p] = m
+	}
+	res := &Inventory{
+		inv:      inv,
+		RootDir:  i.RootDir,
+		Resolver: i.Resolver,
+		Scan:     i.Scan,
+		logger:   i.logger,
+	}
+
+	changed := make(map[string]*Module)
+	for p, m := range other.inv {
+		if m.Main {
+			continue
+		}
+		if cur, ok := inv[p]; ok && cur.Version == m.Version && cur.Dir == m.Dir {
+			continue
+		}
+		inv[p] = m
+		changed[p] = m
+	}
+
+	if len(changed) == 0 {
+		res.g = g
+		return res, nil
+	}
+	for _, m := range changed {
+		// its packages can't be scanned again, and the graph would keep
+		// imports of packages it no longer has
+		if m.Dir == "" {
+			return nil, fmt.Errorf("%s@%s: no source directory to scan", m.Path, m.Version)
+		}
+	}
+
+	graphs := make([]dependencies.Graph, 0)
+	kept := make(dependencies.Graph)
+	for pkg, n := range g {
+		if m := i.moduleFor(g.PackagePath(pkg)); m != nil && changed[m.Path] != nil {
+			continue
+		}
+		kept[pkg] = n
+	}
+	graphs = append(graphs, kept)
+
+	for _, m := range changed {
+		i.log().Println("scanning packages of", m.Path, m.Version)
+		mg, err := (&dependencies.DepsBuilder{
+			Root:    m.Dir,
+			Package: m.Path,
+			Scan:    i.Scan,
+		}).GetFullDependencyGraph(ctx)
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, mg)
+	}
+
+	res.g, err = dependencies.CombineGraphs(graphs)
+	return res, err
+}
+
+// moduleFor returns the module providing package pkg, if any
+func (i *Inventory) moduleFor(pkg string) *Module {
+	var res *Module
+	for _, m := range i.inv {
+		if pkg != m.Path && !strings.HasPrefix(pkg, m.Path+"/") {
+			continue
+		}
+		if res == nil || len(m.Path) > len(res.Path) {
+			res = m
+		}
+	}
+	return res
+}
+
 func (i *Inventory) GetExternalDependencies() []*Module {
 	res := make([]*Module, 0)
 	for _, m := range i.inv {
@@ -44,10 +190,10 @@ func (i *Inventory) GetSubmodules() []*Module {
 	return res
 }
 
-func (i *Inventory) GetSubmodulesFor(mod string) []string {
+func (i *Inventory) GetSubmodulesFor(ctx context.Context, mod string) []string {
 	res := make([]string, 0)
 
-	g, err := i.getFullDependencyGraph()
+	g, err := i.getFullDependencyGraph(ctx)
 	if err != nil {
 		return res
 	}
@@ -96,50 +242,117 @@ func (i *Inventory) GetMainModule() *Module {
 	return nil
 }
 
-func (i *Inventory) AsGodeps() (*Godeps, error) {
-	tools, err := i.GetTools()
-	if err != nil {
-		return nil, err
-	}
+// LockedModule is a dependency pinned to a commit, along with its packages
+// that are reachable from the main module
+type LockedModule struct {
+	Path    string
+	Version string
+	Rev     string
+	// Packages are relative to Path, "" being the root package
+	Packages []string
+}
 
-	subs, err := i.getSubPackages()
+// Locked returns the dependencies of the main module pinned to their commit,
+// sorted by path. Modules that provide no reachable package are left out.
+func (i *Inventory) Locked(ctx context.Context) ([]*LockedModule, error) {
+	subs, err := i.getSubPackages(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	deps := make([]Dependency, 0)
+	resolver := i.resolver()
+	res := make([]*LockedModule, 0)
+	unresolved := make(map[string]error)
 	for _, m := range i.inv {
-		if m.Main {
+		if m.Main || len(subs[m.Path]) == 0 {
 			continue
 		}
 
-		h, err := m.GetHash()
+		h, err := resolver.Resolve(ctx, m)
 		if err != nil {
-			return nil, err
+			unresolved[m.Path+"@"+m.Version] = err
+			continue
 		}
 
-		for _, sub := range subs[m.Path] {
-			d := Dependency{
-				ImportPath: filepath.Join(m.Path, sub),
-				Rev:        h,
-			}
+		pkgs := append([]string(nil), subs[m.Path]...)
+		sort.Strings(pkgs)
+		res = append(res, &LockedModule{
+			Path:     m.Path,
+			Version:  m.Version,
+			Rev:      h,
+			Packages: pkgs,
+		})
+	}
 
-			if !strings.HasSuffix(m.Version, h[:12]) {
-				d.Comment = m.Version
+	if len(unresolved) > 0 {
+		return nil, &UnresolvedModulesError{
+			Errors: unresolved,
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+func (i *Inventory) resolver() *HashResolver {
+	if i.Resolver != nil {
+		return i.Resolver
+	}
+	return NewHashResolver()
+}
+
+// AsGodeps describes the dependencies of the main module as a Godeps
+// document, whose packages are the tools of tools.go and ./... . Comments hold the `git describe` output of each revision when a
+// checkout of the repository is available, and the module version otherwise,
+// unless it's a pseudo-version.
+func (i *Inventory) AsGodeps(ctx context.Context) (*Godeps, error) {
+	tools, err := i.GetTools()
+	if err != nil {
+		return nil, err
+	}
+
+	mods, err := i.Locked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := i.resolver()
+	deps := make([]Dependency, 0)
+	for _, m := range mods {
+		comment := ""
+		if !strings.HasSuffix(m.Version, m.Rev[:12]) {
+			comment = m.Version
+		}
+		// staging modules aren't tagged on their own
+		if mod := i.GetModule(m.Path); !mod.isLocal() {
+			if desc, err := resolver.Describe(ctx, mod, m.Rev); err == nil {
+				comment = desc
 			}
-			deps = append(deps, d)
+		}
+
+		for _, sub := range m.Packages {
+			deps = append(deps, Dependency{
+				ImportPath: filepath.Join(m.Path, sub),
+				Comment:    comment,
+				Rev:        m.Rev,
+			})
 		}
 	}
 
 	gd := &Godeps{
-		Packages:   tools,
+		Packages:   append(tools, "./..."),
 		ImportPath: i.GetMainModule().Path,
 		Deps:       deps,
 	}
 	return gd, nil
 }
 
-func (i *Inventory) getFullDependencyGraph() (dependencies.Graph, error) {
+func (i *Inventory) getFullDependencyGraph(ctx context.Context) (dependencies.Graph, error) {
+	i.gmu.Lock()
+	defer i.gmu.Unlock()
+
 	if i.g != nil {
 		return i.g, nil
 	}
@@ -159,6 +372,7 @@ func (i *Inventory) getFullDependencyGraph() (dependencies.Graph, error) {
 			Root:        m.Replace.Dir,
 			Package:     m.Path,
 			SkipSubdirs: []string{"vendor"},
+			Scan:        i.Scan,
 		})
 	}
 	skipSubdirs = append(skipSubdirs, "vendor")
@@ -168,6 +382,7 @@ func (i *Inventory) getFullDependencyGraph() (dependencies.Graph, error) {
 		Package:       i.GetMainModule().Path,
 		LocalPackages: localPackages,
 		SkipSubdirs:   skipSubdirs,
+		Scan:          i.Scan,
 	}
 	b.Ingest(mainBuilder)
 
@@ -175,18 +390,22 @@ func (i *Inventory) getFullDependencyGraph() (dependencies.Graph, error) {
 		b.Ingest(&dependencies.DepsBuilder{
 			Root:    m.Dir,
 			Package: m.Path,
+			Scan:    i.Scan,
 		})
 	}
 
-	g, err := b.GetFullDependencyGraph()
-	i.g = g
+	g, err := b.GetFullDependencyGraph(ctx)
+	if ctx.Err() == nil {
+		// don't keep a partial graph around if we got interrupted
+		i.g = g
+	}
 	return g, err
 }
 
-func (i *Inventory) getDependencies() ([]string, error) {
+func (i *Inventory) getDependencies(ctx context.Context) ([]string, error) {
 	pkg := i.GetMainModule().Path
-	log.Println("computing dependencies for", pkg)
-	g, err := i.getFullDependencyGraph()
+	i.log().Println("computing dependencies for", pkg)
+	g, err := i.getFullDependencyGraph(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -194,9 +413,9 @@ func (i *Inventory) getDependencies() ([]string, error) {
 	return g.RecursiveTransitiveClosure(pkg), nil
 }
 
-func (i *Inventory) getSubPackages() (map[string][]string, error) {
+func (i *Inventory) getSubPackages(ctx context.Context) (map[string][]string, error) {
 	subPkgs := make(map[string][]string)
-	deps, err := i.getDependencies()
+	deps, err := i.getDependencies(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,88 @@
+package convert
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+func TestInventorySubmoduleAndOverlay(t *testing.T) {
+	bDir, _ := filepath.Abs(filepath.Join("testdata", "lister", "modcache", "example.com", "b@v1.0.0"))
+
+	inv := NewInventory("/src", []*Module{
+		{Path: "example.com/main", Main: true, Dir: "/src"},
+		{Path: "example.com/sub", Version: "v0.0.0", Dir: "/src/sub", Replace: Replacement{Path: "./sub", Dir: "/src/sub"}},
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v0.9.0"},
+	})
+	inv.g = dependencies.Graph{
+		"example.com/main": {Imports: []string{"example.com/sub"}},
+		"example.com/sub":  {Imports: []string{"example.com/b"}},
+		"example.com/b":    {Imports: []string{"example.com/a"}},
+		"example.com/a":    {},
+	}
+
+	view, err := inv.Submodule(context.Background(), "example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := view.GetMainModule(); m == nil || m.Path != "example.com/sub" {
+		t.Fatalf("unexpected main module: %v", m)
+	}
+	if view.GetModule("example.com/main") != nil {
+		t.Error("main module of the parent should not be part of the view")
+	}
+	if len(view.GetSubmodules()) != 0 {
+		t.Errorf("unexpected submodules: %v", view.GetSubmodules())
+	}
+
+	deps, _ := view.getDependencies(context.Background())
+	if len(deps) != 2 {
+		t.Errorf("unexpected dependencies: %v", deps)
+	}
+
+	other := NewInventory("/src/sub", []*Module{
+		{Path: "example.com/sub", Main: true, Dir: "/src/sub"},
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.0.0", Dir: bDir},
+	})
+	ov, err := view.Overlay(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := ov.GetModule("example.com/b"); m.Version != "v1.0.0" {
+		t.Errorf("overlay not applied: %v", m)
+	}
+	if inv.GetModule("example.com/b").Version != "v0.9.0" {
+		t.Error("overlay modified the original inventory")
+	}
+
+	// example.com/b v1.0.0 doesn't import anything
+	deps, _ = ov.getDependencies(context.Background())
+	if len(deps) != 1 || deps[0] != "example.com/b" {
+		t.Errorf("unexpected dependencies after overlay: %v", deps)
+	}
+}
+
+func TestInventoryOverlayWithoutDir(t *testing.T) {
+	inv := NewInventory("/src", []*Module{
+		{Path: "example.com/main", Main: true, Dir: "/src"},
+		{Path: "example.com/b", Version: "v0.9.0"},
+	})
+	inv.g = dependencies.Graph{
+		"example.com/main": {Imports: []string{"example.com/b"}},
+		"example.com/b":    {},
+	}
+
+	other := NewInventory("/src", []*Module{
+		{Path: "example.com/main", Main: true, Dir: "/src"},
+		{Path: "example.com/b", Version: "v1.0.0"},
+	})
+	_, err := inv.Overlay(context.Background(), other)
+	if err == nil || !strings.Contains(err.Error(), "example.com/b@v1.0.0") {
+		t.Errorf("expected an error naming the module, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blang/semver"
+)
+
+// ModuleLister computes the build list of a module
+type ModuleLister interface {
+	// ListModules returns the build list of the module rooted at dir, as
+	// described by modFile (dir/go.mod if empty)
+	ListModules(ctx context.Context, dir, modFile string) ([]*Module, error)
+}
+
+// NewInventory builds an Inventory for the module rooted at dir
+func NewInventory(dir string, mods []*Module) *Inventory {
+	inv := make(map[string]*Module)
+	for _, m := range mods {
+		inv[m.Path] = m
+	}
+	return &Inventory{
+		inv:     inv,
+		RootDir: dir,
+	}
+}
+
+// GoLister lists modules by running `go list -m all`
+type GoLister struct {
+	// Timeout bounds the duration of the go command, if set
+	Timeout time.Duration
+}
+
+func (l *GoLister) ListModules(ctx context.Context, dir, modFile string) ([]*Module, error) {
+	r := &VgoRunner{
+		RootDir: dir,
+		ModFile: modFile,
+		Timeout: l.Timeout,
+	}
+	// -mod=readonly keeps working once a vendor directory exists
+	out, err := r.runGo(ctx, "list", "-mod=readonly", "-json", "-m", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Module, 0)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m Module
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, &m)
+	}
+	return res, nil
+}
+
+// ModCacheLister lists modules by reading go.mod files directly, from the
+// filesystem for local replacements and from the module cache for everything
+// else. It doesn't need a Go toolchain, but expects all required modules to
+// be in the cache already.
+type ModCacheLister struct {
+	// ModCache is the root of the module cache. Defaults to $GOMODCACHE,
+	// or $GOPATH/pkg/mod.
+	ModCache string
+}
+
+func (l *ModCacheLister) ListModules(ctx context.Context, dir, modFile string) ([]*Module, error) {
+	if modFile == "" {
+		modFile = filepath.Join(dir, "go.mod")
+	}
+	main, err := parseModFile(modFile)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &buildList{
+		main:     main.Module,
+		cache:    l.modCache(),
+		dir:      dir,
+		replace:  main.Replace,
+		selected: make(map[string]string),
+		visited:  make(map[modVersion]bool),
+	}
+	err = b.walk(ctx, main.Require)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*Module{
+		{
+			Path:  main.Module,
+			Main:  true,
+			Dir:   dir,
+			GoMod: modFile,
+		},
+	}
+	paths := make([]string, 0, len(b.selected))
+	for p := range b.selected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		res = append(res, b.module(modVersion{p, b.selected[p]}))
+	}
+	return res, nil
+}
+
+func (l *ModCacheLister) modCache() string {
+	if l.ModCache != "" {
+		return l.ModCache
+	}
+	if c := os.Getenv("GOMODCACHE"); c != "" {
+		return c
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, _ := os.UserHomeDir()
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+// buildList implements minimal version selection over the go.mod files
+// reachable from the main module
+type buildList struct {
+	main     string
+	cache    string
+	dir      string
+	replace  []modReplace
+	selected map[string]string
+	visited  map[modVersion]bool
+}
+
+func (b *buildList) walk(ctx context.Context, reqs []modVersion) error {
+	for len(reqs) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		mv := reqs[0]
+		reqs = reqs[1:]
+		if b.visited[mv] || mv.Path == b.main {
+			continue
+		}
+		b.visited[mv] = true
+
+		if cur, ok := b.selected[mv.Path]; !ok || compareVersions(cur, mv.Version) < 0 {
+			b.selected[mv.Path] = mv.Version
+		}
+
+		m := b.module(mv)
+		mf, err := parseModFile(m.GoMod)
+		if os.IsNotExist(err) && m.Replace.Path == "" {
+			return fmt.Errorf("%s@%s: not found in module cache %s", mv.Path, mv.Version, b.cache)
+		}
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, mf.Require...)
+	}
+	return nil
+}
+
+// module describes mv as `go list -m` would, taking replacements into
+// account
+func (b *buildList) module(mv modVersion) *Module {
+	m := &Module{
+		Path:    mv.Path,
+		Version: mv.Version,
+	}
+
+	target := mv
+	if r := b.replacement(mv); r != nil {
+		m.Replace.Path = r.New.Path
+		m.Replace.Version = r.New.Version
+		target = r.New
+		if r.New.Version == "" {
+			// local directory
+			dir := r.New.Path
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(b.dir, dir)
+			}
+			m.Replace.Dir = dir
+			m.Replace.GoMod = filepath.Join(dir, "go.mod")
+			m.Dir = m.Replace.Dir
+			m.GoMod = m.Replace.GoMod
+			return m
+		}
+	}
+
+	dir := filepath.Join(b.cache, escapePath(target.Path)+"@"+escapePath(target.Version))
+	if _, err := os.Stat(dir); err != nil {
+		dir = ""
+	}
+	goMod := filepath.Join(b.cache, "cache", "download", escapePath(target.Path), "@v", escapePath(target.Version)+".mod")
+
+	if target != mv {
+		m.Replace.Dir = dir
+		m.Replace.GoMod = goMod
+	}
+	m.Dir = dir
+	m.GoMod = goMod
+	return m
+}
+
+func (b *buildList) replacement(mv modVersion) *modReplace {
+	var res *modReplace
+	for i, r := range b.replace {
+		if r.Old.Path != mv.Path {
+			continue
+		}
+		if r.Old.Version == mv.Version {
+			return &b.replace[i]
+		}
+		if r.Old.Version == "" {
+			res = &b.replace[i]
+		}
+	}
+	return res
+}
+
+// escapePath encodes a module path or version the way the module cache does,
+// replacing upper case letters with '!' followed by the lower case letter
+func escapePath(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func compareVersions(a, b string) int {
+	va, erra := semver.Parse(strings.TrimPrefix(a, "v"))
+	vb, errb := semver.Parse(strings.TrimPrefix(b, "v"))
+	if erra != nil || errb != nil {
+		return strings.Compare(a, b)
+	}
+	return va.Compare(vb)
+}
@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestModCacheLister(t *testing.T) {
+	root, _ := filepath.Abs(filepath.Join("testdata", "lister"))
+	dir := filepath.Join(root, "main")
+	cache := filepath.Join(root, "modcache")
+
+	l := &ModCacheLister{ModCache: cache}
+	mods, err := l.ListModules(context.Background(), dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := NewInventory(dir, mods)
+
+	if m := inv.GetMainModule(); m == nil || m.Path != "example.com/main" {
+		t.Errorf("unexpected main module: %v", m)
+	}
+
+	if m := inv.GetModule("example.com/a"); m == nil || m.Version != "v1.1.0" {
+		t.Errorf("expected example.com/a v1.1.0 to be selected, got %v", m)
+	}
+
+	b := inv.GetModule("example.com/b")
+	if b == nil {
+		t.Fatal("example.com/b not found")
+	}
+	if b.Dir != filepath.Join(cache, "example.com", "b@v1.0.0") {
+		t.Errorf("unexpected Dir for example.com/b: %s", b.Dir)
+	}
+
+	u := inv.GetModule("example.com/Upper")
+	if u == nil {
+		t.Fatal("example.com/Upper not found")
+	}
+	if u.GoMod != filepath.Join(cache, "cache", "download", "example.com", "!upper", "@v", "v1.0.0.mod") {
+		t.Errorf("unexpected GoMod for example.com/Upper: %s", u.GoMod)
+	}
+	if u.Dir != "" {
+		t.Errorf("expected no Dir for example.com/Upper, got %s", u.Dir)
+	}
+
+	subs := inv.GetSubmodules()
+	if len(subs) != 1 || subs[0].Path != "example.com/local" {
+		t.Fatalf("unexpected submodules: %v", subs)
+	}
+	if subs[0].Replace.Dir != filepath.Join(dir, "staging", "local") {
+		t.Errorf("unexpected replacement dir: %s", subs[0].Replace.Dir)
+	}
+}
+
+func TestModCacheListerMissingModule(t *testing.T) {
+	root, _ := filepath.Abs(filepath.Join("testdata", "lister"))
+	l := &ModCacheLister{ModCache: filepath.Join(root, "empty")}
+	if _, err := l.ListModules(context.Background(), filepath.Join(root, "main"), ""); err == nil {
+		t.Error("expected an error for modules missing from the cache")
+	}
+}
+
+func TestParseModContent(t *testing.T) {
+	mf, err := parseModContent([]byte(`// Generated
+module "example.com/m"
+
+go 1.12
+
+require example.com/a v1.0.0
+replace (
+	example.com/a v1.0.0 => example.com/fork v1.0.1
+	example.com/b => ../b // local
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mf.Module != "example.com/m" {
+		t.Errorf("unexpected module: %s", mf.Module)
+	}
+	if len(mf.Require) != 1 || mf.Require[0] != (modVersion{"example.com/a", "v1.0.0"}) {
+		t.Errorf("unexpected requirements: %v", mf.Require)
+	}
+	expected := []modReplace{
+		{modVersion{"example.com/a", "v1.0.0"}, modVersion{"example.com/fork", "v1.0.1"}},
+		{modVersion{"example.com/b", ""}, modVersion{"../b", ""}},
+	}
+	if len(mf.Replace) != len(expected) {
+		t.Fatalf("unexpected replacements: %v", mf.Replace)
+	}
+	for i := range expected {
+		if mf.Replace[i] != expected[i] {
+			t.Errorf("unexpected replacement: %v", mf.Replace[i])
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LockFormat renders pinned dependencies in the lock file format of a
+// dependency manager
+type LockFormat struct {
+	// File is the name of the lock file, at the root of the module
+	File   string
+	Render func(mods []*LockedModule) []byte
+}
+
+// LockFormats lists the supported lock file formats, by name of the
+// dependency manager. Lock files record the pinned revisions for tools that
+// read them, such as license or security scanners: they can't be consumed by
+// the dependency managers themselves. Checksums and digests are left out, and
+// locally replaced modules have the LocalHash placeholder revision unless
+// staging commits are recorded.
+var LockFormats = map[string]*LockFormat{
+	"dep":   {File: "Gopkg.lock", Render: renderGopkgLock},
+	"glide": {File: "glide.lock", Render: renderGlideLock},
+	"vndr":  {File: "vendor.conf", Render: renderVendorConf},
+}
+
+// lockedRepo is a repository pinned to a commit, as seen by dependency
+// managers that predate modules
+type lockedRepo struct {
+	Root string
+	// Tag is the release tag of the commit, if any
+	Tag string
+	Rev string
+	// Packages are relative to Root, "." being the root package
+	Packages []string
+}
+
+// groupByRepo gathers the packages of mods by repository. Modules whose
+// repository can't be guessed, or that disagree on its revision, are kept
+// as their own repository.
+func groupByRepo(mods []*LockedModule) []*lockedRepo {
+	repos := make(map[string]*lockedRepo)
+	for _, m := range mods {
+		for _, sub := range m.Packages {
+			pkg := path.Join(m.Path, sub)
+			root, rel, err := GuessRepo(pkg)
+			if err != nil || (repos[root] != nil && repos[root].Rev != m.Rev) {
+				root, rel = m.Path, sub
+				if rel == "" {
+					rel = "."
+				}
+			}
+
+			r, ok := repos[root]
+			if !ok {
+				r = &lockedRepo{
+					Root: root,
+					Rev:  m.Rev,
+				}
+				if m.Rev != LocalHash {
+					r.Tag, _ = tagVersion(root, m.Version)
+					r.Tag = strings.TrimSuffix(r.Tag, "+incompatible")
+				}
+				repos[root] = r
+			}
+			r.Packages = append(r.Packages, rel)
+		}
+	}
+
+	res := make([]*lockedRepo, 0, len(repos))
+	for _, r := range repos {
+		sort.Strings(r.Packages)
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Root < res[j].Root
+	})
+	return res
+}
+
+// renderGopkgLock renders the lock file of dep, without the digests
+// `dep ensure` checks
+func renderGopkgLock(mods []*LockedModule) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# This file is autogenerated, do not edit; changes may be undone by the next 'dep ensure'.")
+	fmt.Fprintln(&b)
+
+	for _, r := range groupByRepo(mods) {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "[[projects]]")
+		fmt.Fprintf(&b, "  name = %s\n", strconv.Quote(r.Root))
+		fmt.Fprintln(&b, "  packages = [")
+		for _, p := range r.Packages {
+			fmt.Fprintf(&b, "    %s,\n", strconv.Quote(p))
+		}
+		fmt.Fprintln(&b, "  ]")
+		fmt.Fprintf(&b, "  revision = %s\n", strconv.Quote(r.Rev))
+		if r.Tag != "" {
+			fmt.Fprintf(&b, "  version = %s\n", strconv.Quote(r.Tag))
+		}
+	}
+
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "[solve-meta]")
+	fmt.Fprintln(&b, `  analyzer-name = "dep"`)
+	fmt.Fprintln(&b, "  analyzer-version = 1")
+	fmt.Fprintln(&b, `  solver-name = "gps-cdcl"`)
+	fmt.Fprintln(&b, "  solver-version = 1")
+	return b.Bytes()
+}
+
+// renderGlideLock renders the lock file of glide. The hash and update time
+// are left out, they would change on every run, so `glide install` rejects
+// the file.
+func renderGlideLock(mods []*LockedModule) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "imports:")
+	for _, r := range groupByRepo(mods) {
+		fmt.Fprintf(&b, "- name: %s\n", r.Root)
+		fmt.Fprintf(&b, "  version: %s\n", r.Rev)
+
+		subs := make([]string, 0)
+		for _, p := range r.Packages {
+			if p != "." {
+				subs = append(subs, p)
+			}
+		}
+		if len(subs) > 0 {
+			fmt.Fprintln(&b, "  subpackages:")
+			for _, p := range subs {
+				fmt.Fprintf(&b, "  - %s\n", p)
+			}
+		}
+	}
+	fmt.Fprintln(&b, "testImports: []")
+	return b.Bytes()
+}
+
+// renderVendorConf renders the configuration file of vndr
+func renderVendorConf(mods []*LockedModule) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# GENERATED FROM VGO, DO NOT EDIT")
+	for _, r := range groupByRepo(mods) {
+		fmt.Fprintln(&b, r.Root, r.Rev)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"testing"
+)
+
+var lockedModules = []*LockedModule{
+	{Path: "github.com/foo/bar", Version: "v1.2.0", Rev: "aaaa", Packages: []string{"", "sub"}},
+	{Path: "github.com/foo/bar/v3", Version: "v3.0.0", Rev: "aaaa", Packages: []string{"pkg"}},
+	{Path: "gopkg.in/yaml.v2", Version: "v2.2.1", Rev: "bbbb", Packages: []string{""}},
+	{Path: "k8s.io/api", Version: "v0.0.0", Rev: LocalHash, Packages: []string{"core/v1"}},
+	{Path: "k8s.io/utils", Version: "v0.0.0-20180906233101-cccccccccccc", Rev: "cccccccccccc", Packages: []string{"net"}},
+}
+
+func TestGopkgLock(t *testing.T) {
+	expected := `# This file is autogenerated, do not edit; changes may be undone by the next 'dep ensure'.
+
+
+[[projects]]
+  name = "github.com/foo/bar"
+  packages = [
+    ".",
+    "sub",
+    "v3/pkg",
+  ]
+  revision = "aaaa"
+  version = "v1.2.0"
+
+[[projects]]
+  name = "gopkg.in/yaml.v2"
+  packages = [
+    ".",
+  ]
+  revision = "bbbb"
+  version = "v2.2.1"
+
+[[projects]]
+  name = "k8s.io/api"
+  packages = [
+    "core/v1",
+  ]
+  revision = "` + LocalHash + `"
+
+[[projects]]
+  name = "k8s.io/utils"
+  packages = [
+    "net",
+  ]
+  revision = "cccccccccccc"
+
+[solve-meta]
+  analyzer-name = "dep"
+  analyzer-version = 1
+  solver-name = "gps-cdcl"
+  solver-version = 1
+`
+	if got := string(renderGopkgLock(lockedModules)); got != expected {
+		t.Errorf("unexpected Gopkg.lock:\n%s", got)
+	}
+}
+
+func TestGlideLock(t *testing.T) {
+	expected := `imports:
+- name: github.com/foo/bar
+  version: aaaa
+  subpackages:
+  - sub
+  - v3/pkg
+- name: gopkg.in/yaml.v2
+  version: bbbb
+- name: k8s.io/api
+  version: ` + LocalHash + `
+  subpackages:
+  - core/v1
+- name: k8s.io/utils
+  version: cccccccccccc
+  subpackages:
+  - net
+testImports: []
+`
+	if got := string(renderGlideLock(lockedModules)); got != expected {
+		t.Errorf("unexpected glide.lock:\n%s", got)
+	}
+}
+
+func TestVendorConf(t *testing.T) {
+	expected := `# GENERATED FROM VGO, DO NOT EDIT
+github.com/foo/bar aaaa
+gopkg.in/yaml.v2 bbbb
+k8s.io/api ` + LocalHash + `
+k8s.io/utils cccccccccccc
+`
+	if got := string(renderVendorConf(lockedModules)); got != expected {
+		t.Errorf("unexpected vendor.conf:\n%s", got)
+	}
+}
+
+func TestGroupByRepoConflict(t *testing.T) {
+	repos := groupByRepo([]*LockedModule{
+		{Path: "github.com/foo/bar", Version: "v1.2.0", Rev: "aaaa", Packages: []string{""}},
+		{Path: "github.com/foo/bar/v3", Version: "v3.0.0", Rev: "dddd", Packages: []string{""}},
+	})
+	if len(repos) != 2 || repos[1].Root != "github.com/foo/bar/v3" || repos[1].Packages[0] != "." {
+		t.Errorf("unexpected repositories: %v", repos)
+	}
+}
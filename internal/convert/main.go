@@ -1,79 +1,734 @@
 package convert
 
 import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
 )
 
 type Converter struct {
 	RootDir     string
 	GodepCompat bool
+	// Include restricts the run to submodules whose path matches one of
+	// these globs. An empty list selects every submodule.
+	Include []string
+	// Exclude skips submodules whose path matches one of these globs.
+	Exclude []string
+	// Lister computes module inventories. Defaults to running the go
+	// command.
+	Lister ModuleLister
+	// Parallelism is the number of submodules processed concurrently.
+	// Defaults to 1.
+	Parallelism int
+	// Resolver finds commit hashes for Godeps.json. Defaults to
+	// NewHashResolver().
+	Resolver *HashResolver
+	// GoTimeout bounds the duration of each go command, if set.
+	GoTimeout time.Duration
+	// MergeGodeps keeps the GoVersion, GodepVersion and Packages of existing
+	// Godeps.json files, only their dependencies are regenerated.
+	MergeGodeps bool
+	// GodepsMeta overrides the metadata of generated Godeps.json files. Only
+	// GoVersion, GodepVersion and Packages are considered, when set.
+	GodepsMeta Godeps
+	// Locks lists the additional lock files to generate next to
+	// Godeps.json, by name in LockFormats.
+	Locks []string
+	// Output receives the generated files. Defaults to writing them in
+	// place once the whole run succeeded.
+	Output Output
+	// Scan selects the files whose imports are considered. Defaults to all
+	// of them.
+	Scan dependencies.ScanOptions
+}
+
+// GenFiles generates go.mod and Godeps.json files for all selected
+// submodules, and reports the outcome for each of them. Unless an Output is
+// configured, files are staged in memory and only written once every one of
+// them has been generated successfully.
+func (c *Converter) GenFiles(ctx context.Context) (*Report, error) {
+	if c.Output != nil {
+		return c.genFiles(ctx, c.Output)
+	}
+
+	staged := &StagedOutput{RootDir: c.RootDir}
+	rep, err := c.genFiles(ctx, staged)
+	if err != nil {
+		return rep, err
+	}
+	log.Println("writing generated files")
+	return rep, staged.Commit()
 }
 
-func (c *Converter) GenFiles() error {
+func (c *Converter) genFiles(ctx context.Context, out Output) (*Report, error) {
 	r := &VgoRunner{
 		RootDir: c.RootDir,
+		Lister:  c.Lister,
+		Timeout: c.GoTimeout,
 	}
 
 	log.Println("getting inventory")
-	inv, err := r.GetInventory()
+	inv, err := r.GetInventory(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	inv.Resolver = c.Resolver
+	inv.Scan = c.Scan
 
 	if c.GodepCompat {
 		log.Println("computing top-level godeps.json")
-		gd, err := inv.AsGodeps()
+		var goMod []byte
+		if m := inv.GetMainModule(); m.GoMod != "" {
+			goMod, err = readExisting(m.GoMod)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = c.genGodeps(ctx, inv, goMod, out)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		log.Println("dumping top-level godeps.json")
-		err = gd.DumpToFile(filepath.Join(c.RootDir, "Godeps", "Godeps.json"))
+	}
+	if len(c.Locks) > 0 {
+		log.Println("computing top-level lock files")
+		err = c.genLocks(ctx, inv, out)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	mods := make([]*Module, 0)
 	for _, m := range inv.GetSubmodules() {
-		log.Println("considering submodule:", m.Path)
-		r.GenVgoMod(m.Path)
-		sr := &VgoRunner{
-			RootDir: m.Replace.Dir,
+		if !c.isSelected(m.Path) {
+			log.Println("skipping submodule:", m.Path)
+			continue
 		}
-		sr.Tidy()
+		mods = append(mods, m)
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].Path < mods[j].Path
+	})
 
-		if c.GodepCompat {
-			log.Println("getting inventory")
-			sinv, err := sr.GetInventory()
-			if err != nil {
-				return err
+	rep := &Report{}
+	for _, res := range c.genSubmodules(ctx, r, inv, mods) {
+		// results come back in order, flush them as they are
+		<-res.done
+		log.Writer().Write(res.logs.Bytes())
+		// files of failed submodules are partial, keep them out
+		if res.report.Error == nil {
+			if err := res.files.flushTo(out); err != nil {
+				res.report.Error = newStepError(stepWrite, err)
 			}
-			log.Println("computing godeps.json")
-			gd, err := sinv.AsGodeps()
-			if err != nil {
-				return err
+		}
+		rep.Submodules = append(rep.Submodules, res.report)
+	}
+
+	if n := len(rep.Failed()); n > 0 {
+		return rep, fmt.Errorf("%d submodule(s) failed", n)
+	}
+	return rep, nil
+}
+
+// genGodeps generates the Godeps.json file of inv. goMod is the content of
+// the matching go.mod file, whose go directive sets GoVersion.
+func (c *Converter) genGodeps(ctx context.Context, inv *Inventory, goMod []byte, out Output) error {
+	gd, err := inv.AsGodeps(ctx)
+	if err != nil {
+		return err
+	}
+
+	fname := filepath.Join(inv.RootDir, "Godeps", "Godeps.json")
+	err = c.setGodepsMeta(gd, fname, goMod)
+	if err != nil {
+		return err
+	}
+
+	js, err := gd.Render()
+	if err != nil {
+		return err
+	}
+	inv.log().Println("dumping godeps.json")
+	return out.WriteFile(fname, js)
+}
+
+// setGodepsMeta fills in the metadata of gd. In order of precedence, values
+// come from GodepsMeta, the go directive of goMod, and the existing file
+// fname when merging. Render takes care of anything left unset.
+func (c *Converter) setGodepsMeta(gd *Godeps, fname string, goMod []byte) error {
+	if c.MergeGodeps {
+		old, err := LoadGodeps(fname)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			gd.Merge(old)
+		}
+	}
+
+	if goMod != nil {
+		mf, err := parseModContent(goMod)
+		if err != nil {
+			return err
+		}
+		if mf.Go != "" {
+			gd.GoVersion = shortGoVersion("go" + mf.Go)
+		}
+	}
+
+	if c.GodepsMeta.GoVersion != "" {
+		gd.GoVersion = c.GodepsMeta.GoVersion
+	}
+	if c.GodepsMeta.GodepVersion != "" {
+		gd.GodepVersion = c.GodepsMeta.GodepVersion
+	}
+	if len(c.GodepsMeta.Packages) > 0 {
+		gd.Packages = append([]string(nil), c.GodepsMeta.Packages...)
+	}
+	return nil
+}
+
+// genLocks generates the lock files of inv in the formats listed in Locks
+func (c *Converter) genLocks(ctx context.Context, inv *Inventory, out Output) error {
+	mods, err := inv.Locked(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range c.Locks {
+		f, ok := LockFormats[name]
+		if !ok {
+			return fmt.Errorf("unknown lock format %s", name)
+		}
+		inv.log().Println("dumping", f.File)
+		err = out.WriteFile(filepath.Join(inv.RootDir, f.File), f.Render(mods))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type submoduleResult struct {
+	done   chan struct{}
+	report *SubmoduleReport
+	files  *StagedOutput
+	logs   bytes.Buffer
+}
+
+// genSubmodules processes mods with up to Parallelism workers. Each result is
+// buffered, and its done channel closed once it's complete.
+func (c *Converter) genSubmodules(ctx context.Context, r *VgoRunner, inv *Inventory, mods []*Module) []*submoduleResult {
+	results := make([]*submoduleResult, len(mods))
+	for i := range results {
+		results[i] = &submoduleResult{
+			done:  make(chan struct{}),
+			files: &StagedOutput{},
+		}
+	}
+
+	jobs := make(chan int)
+	for w := 0; w < c.parallelism(); w++ {
+		go func() {
+			for i := range jobs {
+				res := results[i]
+				logger := log.New(&res.logs, log.Prefix(), log.Flags())
+				res.report = c.genSubmodule(ctx, r, inv, mods[i], res.files, logger)
+				close(res.done)
 			}
-			log.Println("dumping godeps.json")
-			err = gd.DumpToFile(filepath.Join(m.Replace.Dir, "Godeps", "Godeps.json"))
+		}()
+	}
+	go func() {
+		for i := range mods {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	return results
+}
+
+func (c *Converter) parallelism() int {
+	if c.Parallelism < 1 {
+		return 1
+	}
+	return c.Parallelism
+}
+
+// genSubmodule generates the files for submodule m. go.mod is rendered and
+// tidied in a scratch directory so that nothing is modified in place before
+// the result is handed to out.
+func (c *Converter) genSubmodule(ctx context.Context, r *VgoRunner, inv *Inventory, m *Module, out Output, logger *log.Logger) *SubmoduleReport {
+	logger.Println("considering submodule:", m.Path)
+	rep := &SubmoduleReport{
+		Module: m.Path,
+	}
+	fail := func(step string, err error) *SubmoduleReport {
+		logger.Printf("%s: %s failed: %v", m.Path, step, err)
+		rep.Error = newStepError(step, err)
+		return rep
+	}
+
+	content, err := r.RenderVgoMod(ctx, m.Path)
+	if err != nil {
+		return fail(stepGenerate, err)
+	}
+
+	tmp, err := ioutil.TempDir("", "propagate-deps")
+	if err != nil {
+		return fail(stepGenerate, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	modFile := filepath.Join(tmp, "go.mod")
+	err = prepareModFile(modFile, content, m.Replace.Dir)
+	if err != nil {
+		return fail(stepGenerate, err)
+	}
+	rep.Generated = true
+
+	sr := &VgoRunner{
+		RootDir: m.Replace.Dir,
+		ModFile: modFile,
+		Lister:  c.Lister,
+		Timeout: c.GoTimeout,
+	}
+	err = sr.Tidy(ctx)
+	if err != nil {
+		return fail(stepTidy, err)
+	}
+
+	tidied := make(map[string][]byte)
+	for _, f := range []string{"go.mod", "go.sum"} {
+		content, err := readExisting(filepath.Join(tmp, f))
+		if err == nil && content != nil {
+			tidied[f] = content
+			err = out.WriteFile(filepath.Join(m.Replace.Dir, f), content)
+		}
+		if err != nil {
+			return fail(stepTidy, err)
+		}
+	}
+	rep.Tidied = true
+
+	if !c.GodepCompat && len(c.Locks) == 0 {
+		return rep
+	}
+
+	logger.Println("getting inventory")
+	sinv, err := submoduleInventory(ctx, inv, m.Path, sr, tidied["go.mod"], logger)
+	if err != nil {
+		return fail(stepInventory, err)
+	}
+
+	if c.GodepCompat {
+		logger.Println("computing godeps.json")
+		err = c.genGodeps(ctx, sinv, tidied["go.mod"], out)
+		if err != nil {
+			return fail(stepGodeps, err)
+		}
+		rep.Godeps = true
+	}
+
+	if len(c.Locks) > 0 {
+		logger.Println("computing lock files")
+		err = c.genLocks(ctx, sinv, out)
+		if err != nil {
+			return fail(stepLocks, err)
+		}
+		rep.Locks = true
+	}
+	return rep
+}
+
+// submoduleInventory derives the inventory of submodule mod from the one of
+// the main module. The build list of the submodule is only computed if
+// tidying made its requirements diverge from the main module, and only the
+// modules that changed get their packages scanned again.
+func submoduleInventory(ctx context.Context, inv *Inventory, mod string, sr *VgoRunner, goMod []byte, logger *log.Logger) (*Inventory, error) {
+	view, err := inv.Submodule(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+	view.logger = logger
+
+	mf, err := parseModContent(goMod)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range mf.Require {
+		if m := inv.GetModule(req.Path); m == nil || m.Version != req.Version {
+			logger.Println("requirements of", mod, "diverge from main module, listing modules")
+			sinv, err := sr.GetInventory(ctx)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			return view.Overlay(ctx, sinv)
 		}
 	}
+	return view, nil
+}
 
+// prepareModFile writes content to modFile, along with a copy of the current
+// go.sum of the module in dir so that tidying doesn't start from scratch.
+func prepareModFile(modFile string, content []byte, dir string) error {
+	err := ioutil.WriteFile(modFile, content, 0644)
+	if err != nil {
+		return err
+	}
+	sum, err := readExisting(filepath.Join(dir, "go.sum"))
+	if err != nil || sum == nil {
+		return err
+	}
+	sumFile := strings.TrimSuffix(modFile, ".mod") + ".sum"
+	return ioutil.WriteFile(sumFile, sum, 0644)
+}
+
+func (c *Converter) isSelected(mod string) bool {
+	if len(c.Include) > 0 && !matchAny(c.Include, mod) {
+		return false
+	}
+	return !matchAny(c.Exclude, mod)
+}
+
+func matchAny(globs []string, mod string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, mod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsFlag collects the values of a repeatable, comma-separated flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	for _, p := range strings.Split(v, ",") {
+		if p != "" {
+			*s = append(*s, p)
+		}
+	}
 	return nil
 }
 
+// commands are the subcommands of Main. Without one of them, Main generates
+// go.mod and Godeps.json files.
+var commands = map[string]func(args []string){
+	"changelog":     changelogMain,
+	"check-imports": checkImportsMain,
+	"cycles":        cyclesMain,
+	"graph":         graphMain,
+	"validate":      validateMain,
+	"vendor":        vendorMain,
+	"why":           whyMain,
+}
+
 func Main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	genMain(os.Args[1:])
+}
+
+func genMain(args []string) {
 	cwd, _ := os.Getwd()
-	c := &Converter{
-		RootDir:     cwd,
-		GodepCompat: true,
+	c := &Converter{}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	fs.StringVar(&c.RootDir, "root", cwd, "root directory of the main module")
+	fs.BoolVar(&c.GodepCompat, "godeps", true, "generate Godeps/Godeps.json files")
+	fs.Var((*stringsFlag)(&c.Include), "include", "only process submodules matching these globs (repeatable, comma-separated)")
+	fs.Var((*stringsFlag)(&c.Exclude), "exclude", "skip submodules matching these globs (repeatable, comma-separated)")
+	dryRun := fs.Bool("dry-run", false, "print a diff of the generated files instead of writing them")
+	verify := fs.Bool("verify", false, "fail if any generated file differs from its current version, without writing anything")
+	fs.IntVar(&c.Parallelism, "j", runtime.NumCPU(), "number of submodules processed concurrently")
+	lister := fs.String("lister", "go", listerUsage)
+	fs.DurationVar(&c.GoTimeout, "go-timeout", 0, "maximum duration of each go command (0 for no limit)")
+	timeout := fs.Duration("timeout", 0, "maximum duration of the whole run (0 for no limit)")
+	goproxy := fs.String("goproxy", "", "module proxy queried for revisions missing from the module cache (defaults to $GOPROXY, \"off\" to disable)")
+	stagingCommits := fs.Bool("staging-commits", false, "record the last commit touching each staging directory in Godeps.json, instead of a placeholder")
+	fs.BoolVar(&c.MergeGodeps, "godeps-merge", false, "keep the metadata of existing Godeps.json files, only regenerate their dependencies")
+	fs.StringVar(&c.GodepsMeta.GoVersion, "godeps-go-version", "", "GoVersion recorded in Godeps.json files (defaults to the go directive of go.mod)")
+	fs.StringVar(&c.GodepsMeta.GodepVersion, "godeps-version", "", "GodepVersion recorded in Godeps.json files (defaults to "+GodepCompat+")")
+	fs.Var((*stringsFlag)(&c.GodepsMeta.Packages), "godeps-packages", "Packages recorded in Godeps.json files, instead of ./... (repeatable, comma-separated)")
+	fs.Var((*stringsFlag)(&c.Locks), "locks", "also generate lock files for these dependency managers, for tools reading them but not the managers themselves: dep, glide, vndr (repeatable, comma-separated)")
+	reportFile := fs.String("report", "", "write a JSON report of the run to this file")
+	scan := scanFlags(fs, &c.Scan)
+	verbose := fs.Bool("v", false, "log progress to stderr")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+
+	if *dryRun && *verify {
+		usageError(fs, "-dry-run and -verify are mutually exclusive")
+	}
+
+	var err error
+	c.Lister, err = parseLister(*lister)
+	if err != nil {
+		usageError(fs, err.Error())
+	}
+	if err := scan(); err != nil {
+		usageError(fs, err.Error())
+	}
+
+	for _, l := range c.Locks {
+		if _, ok := LockFormats[l]; !ok {
+			usageError(fs, "unknown lock format: "+l)
+		}
+	}
+
+	c.Resolver = newResolver(*goproxy, *stagingCommits)
+
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
 	}
 
-	err := c.GenFiles()
+	c.RootDir = absRoot(c.RootDir)
+	var check *CheckOutput
+	c.Output, check = newOutput(c.RootDir, *dryRun, *verify)
+
+	ctx, cancel := runContext(*timeout)
+	defer cancel()
+
+	rep, err := c.GenFiles(ctx)
+	if rep != nil {
+		rep.Print(os.Stderr)
+		if *reportFile != "" {
+			if werr := rep.WriteJSON(*reportFile); werr != nil {
+				fmt.Fprintln(os.Stderr, werr)
+				os.Exit(1)
+			}
+		}
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	exitIfStale(c.RootDir, check)
+}
+
+const listerUsage = "how to compute module inventories: \"go\" (go list) or \"modcache\" (read go.mod files and the module cache directly)"
+
+// parseLister returns the ModuleLister named by the -lister flag. nil stands
+// for the default one.
+func parseLister(name string) (ModuleLister, error) {
+	switch name {
+	case "go":
+		return nil, nil
+	case "modcache":
+		return &ModCacheLister{}, nil
+	}
+	return nil, fmt.Errorf("unknown lister: %s", name)
+}
+
+// scanFlags registers the flags selecting the files scanned for imports. By
+// default all files are. The returned function fills opts once fs is parsed.
+func scanFlags(fs *flag.FlagSet, opts *dependencies.ScanOptions) func() error {
+	ctxt := build.Default
+	tags := fs.String("tags", "", "only scan files matching these build tags (comma-separated), along with -goos, -goarch and -cgo")
+	fs.StringVar(&ctxt.GOOS, "goos", ctxt.GOOS, "only scan files matching this GOOS")
+	fs.StringVar(&ctxt.GOARCH, "goarch", ctxt.GOARCH, "only scan files matching this GOARCH")
+	fs.BoolVar(&ctxt.CgoEnabled, "cgo", ctxt.CgoEnabled, "only scan files matching this cgo setting")
+	platforms := fs.String("platforms", "", "scan files for each of these GOOS/GOARCH pairs (comma-separated), recording the platforms of each import")
+
+	return func() error {
+		set := false
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "tags", "goos", "goarch", "cgo", "platforms":
+				set = true
+			}
+		})
+		if !set {
+			return nil
+		}
+
+		for _, t := range strings.Split(*tags, ",") {
+			if t != "" {
+				ctxt.BuildTags = append(ctxt.BuildTags, t)
+			}
+		}
+		ps, err := dependencies.ParsePlatforms(*platforms)
+		if err != nil {
+			return err
+		}
+		opts.Context = &ctxt
+		opts.Platforms = ps
+		return nil
+	}
+}
+
+// newResolver returns the HashResolver matching the -goproxy and
+// -staging-commits flags
+func newResolver(goproxy string, stagingCommits bool) *HashResolver {
+	h := NewHashResolver()
+	h.StagingCommits = stagingCommits
+	if goproxy == "off" {
+		h.Proxy = ""
+	} else if goproxy != "" {
+		h.Proxy = goproxy
+	}
+	return h
+}
+
+func usageError(fs *flag.FlagSet, msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	fs.Usage()
+	os.Exit(2)
+}
+
+// absRoot makes the -root flag absolute, or exits
+func absRoot(dir string) string {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return root
+}
+
+// newOutput returns the Output matching the -dry-run and -verify flags, nil
+// meaning that files are written in place. When verifying, the CheckOutput is
+// returned too.
+func newOutput(root string, dryRun, verify bool) (Output, *CheckOutput) {
+	if dryRun {
+		return &DiffOutput{
+			RootDir: root,
+			W:       os.Stdout,
+		}, nil
+	}
+	if verify {
+		check := &CheckOutput{}
+		return check, check
+	}
+	return nil, nil
+}
+
+// runContext returns a context that is canceled on interrupt, or after
+// timeout if set
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// inventoryFlags are the flags shared by subcommands working on the
+// inventory of the main module
+type inventoryFlags struct {
+	fs        *flag.FlagSet
+	root      *string
+	lister    *string
+	goTimeout *time.Duration
+	timeout   *time.Duration
+	verbose   *bool
+	scan      func() error
+
+	// Dir is the absolute root directory, set by parse
+	Dir  string
+	l    ModuleLister
+	opts dependencies.ScanOptions
+}
+
+// newInventoryFlags registers the inventory flags on fs, along with the
+// flags selecting the files scanned for imports if scan is set
+func newInventoryFlags(fs *flag.FlagSet, scan bool) *inventoryFlags {
+	cwd, _ := os.Getwd()
+	f := &inventoryFlags{
+		fs:        fs,
+		root:      fs.String("root", cwd, "root directory of the main module"),
+		lister:    fs.String("lister", "go", listerUsage),
+		goTimeout: fs.Duration("go-timeout", 0, "maximum duration of each go command (0 for no limit)"),
+		timeout:   fs.Duration("timeout", 0, "maximum duration of the whole run (0 for no limit)"),
+		verbose:   fs.Bool("v", false, "log progress to stderr"),
+	}
+	if scan {
+		f.scan = scanFlags(fs, &f.opts)
+	}
+	return f
+}
+
+// parse checks the inventory flags once fs is parsed, exiting on usage
+// errors, and silences the log unless -v is set
+func (f *inventoryFlags) parse() {
+	var err error
+	if f.l, err = parseLister(*f.lister); err != nil {
+		usageError(f.fs, err.Error())
+	}
+	if f.scan != nil {
+		if err := f.scan(); err != nil {
+			usageError(f.fs, err.Error())
+		}
+	}
+
+	if !*f.verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	f.Dir = absRoot(*f.root)
+}
+
+// context returns the context of the whole run
+func (f *inventoryFlags) context() (context.Context, context.CancelFunc) {
+	return runContext(*f.timeout)
+}
+
+// load returns the inventory of the main module
+func (f *inventoryFlags) load(ctx context.Context) (*Inventory, error) {
+	r := &VgoRunner{
+		RootDir: f.Dir,
+		Lister:  f.l,
+		Timeout: *f.goTimeout,
+	}
+	log.Println("getting inventory")
+	inv, err := r.GetInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv.Scan = f.opts
+	return inv, nil
+}
+
+// exitIfStale lists the stale files found by check, if any, and exits
+func exitIfStale(root string, check *CheckOutput) {
+	if check == nil || len(check.Stale) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "generated files are out of date:")
+	for _, f := range check.Stale {
+		if r, err := filepath.Rel(root, f); err == nil {
+			f = r
+		}
+		fmt.Fprintln(os.Stderr, "\t"+f)
 	}
+	os.Exit(1)
 }
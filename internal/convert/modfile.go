@@ -0,0 +1,149 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// modFile is the subset of a go.mod file needed to compute a build list
+type modFile struct {
+	Module  string
+	Go      string
+	Require []modVersion
+	Replace []modReplace
+}
+
+type modVersion struct {
+	Path    string
+	Version string
+}
+
+type modReplace struct {
+	Old modVersion
+	New modVersion
+}
+
+func parseModFile(fname string) (*modFile, error) {
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := parseModContent(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	return mf, nil
+}
+
+func parseModContent(content []byte) (*modFile, error) {
+	mf := &modFile{}
+	block := ""
+	for n, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields, err := modFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			err = mf.addDirective(block, fields)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+		} else {
+			err = mf.addDirective(fields[0], fields[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+	}
+	if mf.Module == "" {
+		return nil, fmt.Errorf("no module directive")
+	}
+	return mf, nil
+}
+
+func (mf *modFile) addDirective(verb string, args []string) error {
+	switch verb {
+	case "module":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: module path")
+		}
+		mf.Module = args[0]
+	case "go":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: go 1.23")
+		}
+		mf.Go = args[0]
+	case "require":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: require module/path v1.2.3")
+		}
+		mf.Require = append(mf.Require, modVersion{args[0], args[1]})
+	case "replace":
+		arrow := 2
+		if len(args) >= 2 && args[1] == "=>" {
+			arrow = 1
+		}
+		if len(args) < arrow+2 || len(args) > arrow+3 || args[arrow] != "=>" {
+			return fmt.Errorf("usage: replace module/path [v1.2.3] => other/module v1.4 | ../local/directory")
+		}
+		r := modReplace{
+			Old: modVersion{Path: args[0]},
+			New: modVersion{Path: args[arrow+1]},
+		}
+		if arrow == 2 {
+			r.Old.Version = args[1]
+		}
+		if len(args) == arrow+3 {
+			r.New.Version = args[arrow+2]
+		}
+		mf.Replace = append(mf.Replace, r)
+	}
+	// everything else (exclude, retract, toolchain...) is irrelevant
+	// here
+	return nil
+}
+
+// modFields splits a go.mod line into its tokens, unquoting them as needed
+func modFields(line string) ([]string, error) {
+	res := make([]string, 0)
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return res, nil
+		}
+
+		if line[0] == '"' || line[0] == '`' {
+			end := strings.IndexByte(line[1:], line[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(line[:end+2])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, s)
+			line = line[end+2:]
+			continue
+		}
+
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		}
+		res = append(res, line[:end])
+		line = line[end:]
+	}
+}
@@ -0,0 +1,366 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigma/vgo-k8s-tools/internal/diff"
+)
+
+// Output receives the files generated by a run
+type Output interface {
+	WriteFile(fname string, content []byte) error
+	// RemoveFile deletes a file that is no longer generated. Missing files
+	// are ignored.
+	RemoveFile(fname string) error
+}
+
+// DiskOutput writes generated files in place
+type DiskOutput struct {
+	// RootDir bounds the directories removed once emptied by RemoveFile.
+	// Without it, emptied directories are kept.
+	RootDir string
+}
+
+func (o *DiskOutput) WriteFile(fname string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, content, 0644)
+}
+
+func (o *DiskOutput) RemoveFile(fname string) error {
+	err := os.Remove(fname)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		removeEmptyDirs(filepath.Dir(fname), o.RootDir)
+	}
+	return err
+}
+
+// removeEmptyDirs removes dir and its parents, as long as they are empty and
+// strictly inside root
+func removeEmptyDirs(dir, root string) {
+	if root == "" {
+		return
+	}
+	root = filepath.Clean(root)
+	for strings.HasPrefix(dir, root+string(filepath.Separator)) && os.Remove(dir) == nil {
+		dir = filepath.Dir(dir)
+	}
+}
+
+// DiffOutput prints a unified diff between the current and generated version
+// of each file, and leaves the filesystem untouched
+type DiffOutput struct {
+	RootDir string
+	W       io.Writer
+}
+
+func (o *DiffOutput) WriteFile(fname string, content []byte) error {
+	old, err := readExisting(fname)
+	if err != nil {
+		return err
+	}
+
+	rel := fname
+	if r, err := filepath.Rel(o.RootDir, fname); err == nil {
+		rel = r
+	}
+
+	aName := "a/" + rel
+	if old == nil {
+		aName = "/dev/null"
+	}
+	_, err = o.W.Write(diff.Unified(aName, "b/"+rel, old, content))
+	return err
+}
+
+func (o *DiffOutput) RemoveFile(fname string) error {
+	if _, err := os.Lstat(fname); os.IsNotExist(err) {
+		return nil
+	}
+	old, err := readExisting(fname)
+	if err != nil {
+		return err
+	}
+
+	rel := fname
+	if r, err := filepath.Rel(o.RootDir, fname); err == nil {
+		rel = r
+	}
+	if len(old) == 0 {
+		_, err = fmt.Fprintf(o.W, "--- a/%s\n+++ /dev/null\n", rel)
+		return err
+	}
+	_, err = o.W.Write(diff.Unified("a/"+rel, "/dev/null", old, nil))
+	return err
+}
+
+// readExisting returns the current content of fname, or nil if it doesn't
+// exist
+func readExisting(fname string) ([]byte, error) {
+	content, err := ioutil.ReadFile(fname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// CheckOutput records generated files that differ from their current version
+// on disk, and leaves the filesystem untouched
+type CheckOutput struct {
+	Stale []string
+}
+
+func (o *CheckOutput) WriteFile(fname string, content []byte) error {
+	old, err := readExisting(fname)
+	if err != nil {
+		return err
+	}
+	if old == nil || !bytes.Equal(old, content) {
+		o.Stale = append(o.Stale, fname)
+	}
+	return nil
+}
+
+func (o *CheckOutput) RemoveFile(fname string) error {
+	if _, err := os.Lstat(fname); err == nil {
+		o.Stale = append(o.Stale, fname)
+	}
+	return nil
+}
+
+// StagedOutput keeps generated files in memory until Commit is called
+type StagedOutput struct {
+	// RootDir bounds the directories removed once emptied by Commit.
+	// Without it, emptied directories are kept.
+	RootDir string
+
+	files []stagedFile
+	// index maps file names to their position in files
+	index map[string]int
+}
+
+type stagedFile struct {
+	name    string
+	content []byte
+	// remove is set for files to delete
+	remove bool
+	tmp    string
+	backup string
+}
+
+func (o *StagedOutput) WriteFile(fname string, content []byte) error {
+	o.stage(stagedFile{
+		name:    fname,
+		content: content,
+	})
+	return nil
+}
+
+func (o *StagedOutput) RemoveFile(fname string) error {
+	o.stage(stagedFile{
+		name:   fname,
+		remove: true,
+	})
+	return nil
+}
+
+func (o *StagedOutput) stage(f stagedFile) {
+	if i, ok := o.index[f.name]; ok {
+		o.files[i] = f
+		return
+	}
+	if o.index == nil {
+		o.index = make(map[string]int)
+	}
+	o.index[f.name] = len(o.files)
+	o.files = append(o.files, f)
+}
+
+// flushTo hands all staged files over to out, in the order they were staged
+func (o *StagedOutput) flushTo(out Output) error {
+	for _, f := range o.files {
+		var err error
+		if f.remove {
+			err = out.RemoveFile(f.name)
+		} else {
+			err = out.WriteFile(f.name, f.content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit writes all staged files to disk. Each file is first written to a
+// temporary file next to its destination, which is then renamed over it. If
+// anything fails, files that were already replaced get their previous version
+// back, and newly created ones are removed. Files staged for removal are only
+// deleted once everything else succeeded.
+func (o *StagedOutput) Commit() (err error) {
+	var createdDirs []string
+	defer func() {
+		for _, f := range o.files {
+			if f.tmp != "" {
+				os.Remove(f.tmp)
+			}
+		}
+		if err == nil {
+			return
+		}
+		for i := len(createdDirs) - 1; i >= 0; i-- {
+			os.Remove(createdDirs[i])
+		}
+	}()
+
+	for i := range o.files {
+		f := &o.files[i]
+		if f.remove {
+			continue
+		}
+		dirs, err := mkdirAll(filepath.Dir(f.name))
+		createdDirs = append(createdDirs, dirs...)
+		if err != nil {
+			return err
+		}
+		f.tmp, err = writeTemp(f.name, f.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range o.files {
+		err = o.files[i].replace()
+		if err != nil {
+			for j := i; j >= 0; j-- {
+				o.files[j].rollback()
+			}
+			return err
+		}
+	}
+
+	for _, f := range o.files {
+		if f.backup == "" {
+			continue
+		}
+		os.Remove(f.backup)
+		// only directories emptied by this commit are removed
+		if f.remove {
+			removeEmptyDirs(filepath.Dir(f.name), o.RootDir)
+		}
+	}
+	return nil
+}
+
+func (f *stagedFile) replace() error {
+	if f.remove {
+		return f.moveAway()
+	}
+	err := f.moveAway()
+	if err != nil {
+		return err
+	}
+	err = install(f.tmp, f.name)
+	if err != nil {
+		return err
+	}
+	f.tmp = ""
+	return nil
+}
+
+// install moves a temporary file over its destination. Tests replace it to
+// simulate failures.
+var install = os.Rename
+
+// moveAway renames the current version of the file, if any, to a backup
+func (f *stagedFile) moveAway() error {
+	_, err := os.Lstat(f.name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f.backup = f.tmp + ".orig"
+	if f.remove {
+		f.backup = filepath.Join(filepath.Dir(f.name), "."+filepath.Base(f.name)+".orig")
+	}
+	err = os.Rename(f.name, f.backup)
+	if err != nil {
+		f.backup = ""
+	}
+	return err
+}
+
+func (f *stagedFile) rollback() {
+	if f.tmp == "" && !f.remove {
+		// the new version is in place
+		os.Remove(f.name)
+	}
+	if f.backup != "" {
+		os.Rename(f.backup, f.name)
+	}
+}
+
+// writeTemp writes content to a temporary file in the directory of fname,
+// with the permissions of fname if it already exists
+func writeTemp(fname string, content []byte) (string, error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(fname); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), "."+filepath.Base(fname)+".")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// mkdirAll is like os.MkdirAll, but returns the directories it created,
+// outermost first
+func mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	created := make([]string, 0, len(missing))
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := os.Mkdir(missing[i], 0755)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
@@ -0,0 +1,190 @@
+package convert
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStagedOutputCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "go.mod")
+	created := filepath.Join(dir, "Godeps", "Godeps.json")
+	ioutil.WriteFile(existing, []byte("old"), 0644)
+
+	o := &StagedOutput{}
+	o.WriteFile(existing, []byte("new"))
+	o.WriteFile(created, []byte("{}"))
+
+	if c, _ := ioutil.ReadFile(existing); string(c) != "old" {
+		t.Errorf("file modified before commit: %q", c)
+	}
+
+	if err := o.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, _ := ioutil.ReadFile(existing); string(c) != "new" {
+		t.Errorf("unexpected content: %q", c)
+	}
+	if c, _ := ioutil.ReadFile(created); string(c) != "{}" {
+		t.Errorf("unexpected content: %q", c)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("leftover temporary files: %v", entries)
+	}
+}
+
+func TestStagedOutputCommitFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "go.mod")
+	ioutil.WriteFile(existing, []byte("old"), 0644)
+	// a regular file where a directory is expected
+	ioutil.WriteFile(filepath.Join(dir, "blocker"), nil, 0644)
+
+	o := &StagedOutput{}
+	o.WriteFile(existing, []byte("new"))
+	o.WriteFile(filepath.Join(dir, "sub", "go.mod"), []byte("new"))
+	o.WriteFile(filepath.Join(dir, "blocker", "go.mod"), []byte("new"))
+
+	if err := o.Commit(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+
+	if c, _ := ioutil.ReadFile(existing); string(c) != "old" {
+		t.Errorf("file modified by failed commit: %q", c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("directory left behind by failed commit")
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("leftover temporary files: %v", entries)
+	}
+}
+
+func TestStagedOutputCommitRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "go.mod")
+	created := filepath.Join(dir, "sub", "dir", "go.mod")
+	last := filepath.Join(dir, "Godeps.json")
+	ioutil.WriteFile(first, []byte("old"), 0644)
+	ioutil.WriteFile(last, []byte("old"), 0644)
+
+	// fail once the first files are already in place
+	defer func(orig func(string, string) error) { install = orig }(install)
+	installed := make([]string, 0)
+	install = func(tmp, fname string) error {
+		if fname == last {
+			return errors.New("disk full")
+		}
+		installed = append(installed, fname)
+		return os.Rename(tmp, fname)
+	}
+
+	o := &StagedOutput{}
+	o.WriteFile(first, []byte("new"))
+	o.WriteFile(created, []byte("new"))
+	o.WriteFile(last, []byte("new"))
+
+	if err := o.Commit(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if len(installed) != 2 {
+		t.Fatalf("expected the failure after 2 files, got %v", installed)
+	}
+
+	for _, fname := range []string{first, last} {
+		if c, _ := ioutil.ReadFile(fname); string(c) != "old" {
+			t.Errorf("%s not restored: %q", fname, c)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("directory left behind by failed commit")
+	}
+
+	// no backup nor temporary file left
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("leftover files: %v", entries)
+	}
+}
+
+func TestStagedOutputRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	removed := filepath.Join(dir, "vendor", "a", "a.go")
+	kept := filepath.Join(dir, "vendor", "modules.txt")
+	os.MkdirAll(filepath.Dir(removed), 0755)
+	ioutil.WriteFile(removed, []byte("package a"), 0644)
+
+	// empty directories that were already there are left alone
+	empty := filepath.Join(dir, "vendor", "empty")
+	os.MkdirAll(empty, 0755)
+
+	o := &StagedOutput{RootDir: dir}
+	o.RemoveFile(removed)
+	o.RemoveFile(filepath.Join(dir, "missing"))
+	o.RemoveFile(filepath.Join(empty, "missing.go"))
+	o.WriteFile(kept, []byte("# a"))
+
+	if _, err := os.Stat(removed); err != nil {
+		t.Errorf("file removed before commit: %v", err)
+	}
+
+	if err := o.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "a")); !os.IsNotExist(err) {
+		t.Errorf("removed file or its directory left behind: %v", err)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "vendor"))
+	if len(entries) != 2 {
+		t.Errorf("unexpected files: %v", entries)
+	}
+	if _, err := os.Stat(empty); err != nil {
+		t.Errorf("empty directory removed: %v", err)
+	}
+
+	// the root is never removed
+	root := filepath.Join(dir, "root")
+	last := filepath.Join(root, "sub", "last.go")
+	os.MkdirAll(filepath.Dir(last), 0755)
+	ioutil.WriteFile(last, []byte("package sub"), 0644)
+	o = &StagedOutput{RootDir: root}
+	o.RemoveFile(last)
+	if err := o.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory left behind: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package convert
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+// RestrictionsFile is the default name of per-directory import restriction
+// files. It differs from the .import-restrictions files of Kubernetes'
+// import-boss, whose format is different.
+const RestrictionsFile = ".import-rules"
+
+// localDir returns the directory holding the sources of m in the main
+// module tree, if any
+func (i *Inventory) localDir(m *Module) string {
+	switch {
+	case m.Main:
+		return i.RootDir
+	case m.isLocal():
+		return m.Replace.Dir
+	}
+	return ""
+}
+
+// importPathFor returns the import path of the package in dir, which must be
+// part of the main module or of one of its staging modules
+func (i *Inventory) importPathFor(dir string) (string, error) {
+	var best *Module
+	bestDir := ""
+	for _, m := range i.inv {
+		d := i.localDir(m)
+		if d == "" || (dir != d && !strings.HasPrefix(dir, d+string(filepath.Separator))) {
+			continue
+		}
+		if len(d) > len(bestDir) {
+			best, bestDir = m, d
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("%s is not part of any local module", dir)
+	}
+	rel, err := filepath.Rel(bestDir, dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return best.Path, nil
+	}
+	return best.Path + "/" + filepath.ToSlash(rel), nil
+}
+
+// packageDir returns the directory of package pkg, if known
+func (i *Inventory) packageDir(pkg string) string {
+	m := i.moduleFor(pkg)
+	if m == nil {
+		return ""
+	}
+	d := i.localDir(m)
+	if d == "" {
+		d = m.Dir
+	}
+	if d == "" {
+		return ""
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(pkg, m.Path), "/")
+	return filepath.Join(d, filepath.FromSlash(rel))
+}
+
+// LoadRestrictions collects the rules of the files called name in the tree
+// of the main module. Their rules apply by default to the package of the
+// directory holding them, and its subpackages.
+func (i *Inventory) LoadRestrictions(name string) (*dependencies.Policy, error) {
+	p := &dependencies.Policy{}
+	err := filepath.Walk(i.RootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			base := info.Name()
+			if path != i.RootDir && (base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != name {
+			return nil
+		}
+
+		selector, err := i.importPathFor(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		rules, err := dependencies.LoadPolicy(path, selector)
+		if err != nil {
+			return err
+		}
+		p.Add(rules)
+		return nil
+	})
+	return p, err
+}
+
+// CheckImports evaluates p against the dependency graph
+func (i *Inventory) CheckImports(ctx context.Context, p *dependencies.Policy) ([]dependencies.Violation, error) {
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.Check(g, i.packageDir), nil
+}
+
+func checkImportsMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" check-imports", flag.ExitOnError)
+	flags := newInventoryFlags(fs, true)
+	var rules []string
+	fs.Var((*stringsFlag)(&rules), "rules", "central rules files, whose rules must have a selector (repeatable, comma-separated)")
+	name := fs.String("rules-name", RestrictionsFile, "name of per-directory rules files (empty to ignore them)")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+	flags.parse()
+
+	ctx, cancel := flags.context()
+	defer cancel()
+
+	inv, err := flags.load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	policy := &dependencies.Policy{}
+	for _, f := range rules {
+		p, err := dependencies.LoadPolicy(f, "")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		policy.Add(p)
+	}
+	if *name != "" {
+		log.Println("loading", *name, "files")
+		p, err := inv.LoadRestrictions(*name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		policy.Add(p)
+	}
+	log.Println("checking", len(policy.Rules), "rules")
+
+	violations, err := inv.CheckImports(ctx, policy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "%d import restriction(s) violated:\n", len(violations))
+		for _, v := range violations {
+			// report paths relative to the root, as compilers do
+			v.Position.Filename = relPath(flags.Dir, v.Position.Filename)
+			rule := *v.Rule
+			rule.Source = relPath(flags.Dir, rule.Source)
+			v.Rule = &rule
+			fmt.Fprintln(os.Stderr, "\t"+v.String())
+		}
+		os.Exit(1)
+	}
+}
+
+// relPath returns path relative to root if it's inside it, path otherwise
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsAbs(path) || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+func TestCheckImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(fname, content string) {
+		fname = filepath.Join(dir, filepath.FromSlash(fname))
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte(content), 0644)
+	}
+	write("staging/src/k8s.io/api/core/core.go", "package core\n\nimport _ \"k8s.io/kubernetes/pkg\"\n")
+	write("staging/src/k8s.io/api/"+RestrictionsFile, `{"Rules": [{"ForbiddenPrefixes": ["k8s.io/kubernetes"]}]}`)
+	write("pkg/"+RestrictionsFile, `{"Rules": [{"AllowedPrefixes": ["k8s.io/api"]}]}`)
+	write("vendor/example.com/x/"+RestrictionsFile, `not even json`)
+	// import-boss files are left alone
+	write("pkg/.import-restrictions", `{"Rules": [{"SelectorRegexp": "k8s[.]io", "ForbiddenPrefixes": ["k8s.io/api"]}]}`)
+
+	inv := NewInventory(dir, []*Module{
+		{Path: "k8s.io/kubernetes", Main: true, Dir: dir},
+		{Path: "k8s.io/api", Replace: Replacement{Path: "./staging/src/k8s.io/api", Dir: filepath.Join(dir, "staging/src/k8s.io/api")}},
+	})
+	inv.g = dependencies.Graph{
+		"k8s.io/kubernetes/pkg": {Imports: []string{"k8s.io/api/core"}},
+		"k8s.io/api/core":       {Imports: []string{"k8s.io/kubernetes/pkg"}},
+	}
+
+	p, err := inv.LoadRestrictions(RestrictionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectors := make(map[string]bool)
+	for _, r := range p.Rules {
+		selectors[r.Selector] = true
+	}
+	if len(p.Rules) != 2 || !selectors["k8s.io/api"] || !selectors["k8s.io/kubernetes/pkg"] {
+		t.Fatalf("unexpected rules %v", p.Rules)
+	}
+
+	violations, err := inv.CheckImports(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("expected a single violation, got %v", violations)
+	}
+	v := violations[0]
+	expected := filepath.Join(dir, "staging/src/k8s.io/api/core/core.go")
+	if v.Edge.From != "k8s.io/api/core" || v.Position.Filename != expected || v.Position.Line != 3 {
+		t.Errorf("unexpected violation %s", v.String())
+	}
+}
@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GuessRepo splits an import path into its repository and the package path
+// within that repository.
+//
+// ouch, that's horrible. But hey, that's just a transition tool. We'll stop
+// needing it when k8s uses vgo for real.
+func GuessRepo(path string) (string, string, error) {
+	pack := "."
+	if strings.HasPrefix(path, "github.com") ||
+		strings.HasPrefix(path, "golang.org") ||
+		strings.HasPrefix(path, "bitbucket.org") ||
+		strings.HasPrefix(path, "gonum.org") {
+		cpts := strings.SplitN(path, "/", 4)
+		if len(cpts) > 3 {
+			pack = cpts[3]
+		}
+		return strings.Join(cpts[:3], "/"), pack, nil
+	}
+	if strings.HasPrefix(path, "cloud.google.com") ||
+		strings.HasPrefix(path, "google.golang.org") ||
+		strings.HasPrefix(path, "k8s.io") ||
+		strings.HasPrefix(path, "vbom.ml") {
+		cpts := strings.SplitN(path, "/", 3)
+		if len(cpts) > 2 {
+			pack = cpts[2]
+		}
+		return strings.Join(cpts[:2], "/"), pack, nil
+	}
+	if strings.HasPrefix(path, "go4.org") {
+		cpts := strings.SplitN(path, "/", 2)
+		if len(cpts) > 1 {
+			pack = cpts[1]
+		}
+		return strings.Join(cpts[:1], "/"), pack, nil
+	}
+	if strings.HasPrefix(path, "gopkg.in") {
+		r := regexp.MustCompile(`(?P<Repo>.*\.v[0-9]*)(?:/(?P<Path>.*))?`)
+		cpts := r.FindStringSubmatch(path)
+
+		if len(cpts) < 3 {
+			return path, ".", fmt.Errorf("not a valid gopkg.in repo")
+		}
+		if cpts[2] != "" {
+			pack = cpts[2]
+		}
+		return cpts[1], pack, nil
+	}
+
+	return path, ".", fmt.Errorf("don't know how to guess %s", path)
+}
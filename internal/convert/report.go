@@ -0,0 +1,113 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	stepGenerate  = "generate go.mod"
+	stepTidy      = "go mod tidy"
+	stepInventory = "go list -m all"
+	stepGodeps    = "generate Godeps.json"
+	stepLocks     = "generate lock files"
+	stepWrite     = "write files"
+)
+
+// Report summarizes the outcome of a run
+type Report struct {
+	Submodules []*SubmoduleReport
+}
+
+// SubmoduleReport describes what happened to a single submodule
+type SubmoduleReport struct {
+	Module    string
+	Generated bool
+	Tidied    bool
+	Godeps    bool
+	Locks     bool
+	Error     *StepError `json:",omitempty"`
+}
+
+// StepError describes the step that failed for a submodule. Command,
+// ExitCode and Stderr are only set when the failure comes from a go
+// subprocess.
+type StepError struct {
+	Step     string
+	Message  string
+	Command  string `json:",omitempty"`
+	ExitCode int    `json:",omitempty"`
+	Stderr   string `json:",omitempty"`
+}
+
+func newStepError(step string, err error) *StepError {
+	e := &StepError{
+		Step:    step,
+		Message: err.Error(),
+	}
+	var gerr *GoCommandError
+	if errors.As(err, &gerr) {
+		e.Message = gerr.Err.Error()
+		e.Command = strings.Join(gerr.Args, " ")
+		e.ExitCode = gerr.ExitCode
+		e.Stderr = gerr.Stderr
+	}
+	return e
+}
+
+// Failed returns the submodules that could not be processed
+func (r *Report) Failed() []*SubmoduleReport {
+	res := make([]*SubmoduleReport, 0)
+	for _, s := range r.Submodules {
+		if s.Error != nil {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Print writes a summary table of the run, followed by details for each
+// failure
+func (r *Report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tGO.MOD\tTIDY\tGODEPS\tLOCKS\tERROR")
+	for _, s := range r.Submodules {
+		errMsg := ""
+		if s.Error != nil {
+			errMsg = s.Error.Step + " failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Module, status(s.Generated), status(s.Tidied), status(s.Godeps), status(s.Locks), errMsg)
+	}
+	tw.Flush()
+
+	for _, s := range r.Failed() {
+		fmt.Fprintf(w, "\n%s: %s: %s\n", s.Module, s.Error.Step, s.Error.Message)
+		if s.Error.Command != "" {
+			fmt.Fprintf(w, "command: %s\n", s.Error.Command)
+		}
+		if s.Error.Stderr != "" {
+			fmt.Fprintln(w, strings.TrimRight(s.Error.Stderr, "\n"))
+		}
+	}
+}
+
+func status(done bool) string {
+	if done {
+		return "ok"
+	}
+	return "-"
+}
+
+// WriteJSON dumps the report to fname
+func (r *Report) WriteJSON(fname string) error {
+	js, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, append(js, '\n'), 0644)
+}
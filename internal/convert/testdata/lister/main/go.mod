@@ -0,0 +1,10 @@
+module example.com/main
+
+require (
+	example.com/Upper v1.0.0
+	example.com/a v1.0.0
+	example.com/b v1.0.0 // indirect
+	example.com/local v0.0.0
+)
+
+replace example.com/local => ./staging/local
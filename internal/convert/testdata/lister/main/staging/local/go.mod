@@ -0,0 +1,3 @@
+module example.com/local
+
+require example.com/a v1.1.0
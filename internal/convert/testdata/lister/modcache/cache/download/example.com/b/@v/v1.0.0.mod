@@ -0,0 +1,3 @@
+module example.com/b
+
+require example.com/a v1.0.0
@@ -0,0 +1,183 @@
+package convert
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of GodepsProblem
+const (
+	// ProblemMissing is a reachable package absent from Godeps.json
+	ProblemMissing = "missing"
+	// ProblemStale is an entry for a package that is no longer reachable
+	ProblemStale = "stale"
+	// ProblemRev is an entry whose revision doesn't match its module
+	ProblemRev = "revision"
+	// ProblemNoPackage is an entry for a package its module doesn't have
+	ProblemNoPackage = "no package"
+)
+
+// GodepsProblem is an inconsistency between a Godeps document and the
+// inventory it's supposed to describe
+type GodepsProblem struct {
+	ImportPath string
+	Kind       string
+	Message    string
+}
+
+func (p *GodepsProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.ImportPath, p.Kind, p.Message)
+}
+
+// ValidateGodeps cross-checks gd against the inventory, and returns the
+// problems found, sorted by import path. Errors are only returned when the
+// inventory itself can't be computed.
+func (i *Inventory) ValidateGodeps(ctx context.Context, gd *Godeps) ([]*GodepsProblem, error) {
+	subs, err := i.getSubPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reachable := make(map[string]*Module)
+	for _, m := range i.inv {
+		for _, sub := range subs[m.Path] {
+			reachable[filepath.ToSlash(filepath.Join(m.Path, sub))] = m
+		}
+	}
+
+	resolver := i.resolver()
+	hashes := make(map[string]string)
+	hashErrs := make(map[string]error)
+
+	problems := make([]*GodepsProblem, 0)
+	report := func(pkg, kind, format string, args ...interface{}) {
+		problems = append(problems, &GodepsProblem{
+			ImportPath: pkg,
+			Kind:       kind,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	listed := make(map[string]bool)
+	for _, d := range gd.Deps {
+		listed[d.ImportPath] = true
+
+		m := i.moduleFor(d.ImportPath)
+		if m == nil || m.Main {
+			report(d.ImportPath, ProblemStale, "not provided by any dependency")
+			continue
+		}
+
+		if m.Dir != "" {
+			rel := strings.TrimPrefix(strings.TrimPrefix(d.ImportPath, m.Path), "/")
+			if !hasGoFiles(filepath.Join(m.Dir, filepath.FromSlash(rel))) {
+				report(d.ImportPath, ProblemNoPackage, "no such package in %s@%s", m.Path, m.Version)
+				continue
+			}
+		}
+
+		if reachable[d.ImportPath] == nil {
+			report(d.ImportPath, ProblemStale, "not imported by %s", i.GetMainModule().Path)
+		}
+
+		if _, ok := hashes[m.Path]; !ok && hashErrs[m.Path] == nil {
+			hashes[m.Path], hashErrs[m.Path] = resolver.Resolve(ctx, m)
+		}
+		if err := hashErrs[m.Path]; err != nil {
+			report(d.ImportPath, ProblemRev, "can't resolve %s@%s: %v", m.Path, m.Version, err)
+		} else if h := hashes[m.Path]; !sameRev(h, d.Rev) {
+			report(d.ImportPath, ProblemRev, "has %s, %s@%s is %s", d.Rev, m.Path, m.Version, h)
+		}
+	}
+
+	for pkg, m := range reachable {
+		if !m.Main && !listed[pkg] {
+			report(pkg, ProblemMissing, "imported through %s@%s", m.Path, m.Version)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].ImportPath < problems[j].ImportPath
+	})
+	return problems, nil
+}
+
+// minAbbrev is the shortest abbreviated revision accepted, the default of git
+const minAbbrev = 7
+
+// sameRev compares revisions, one of which might be abbreviated
+func sameRev(a, b string) bool {
+	if a == b {
+		return a != ""
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= minAbbrev && strings.HasPrefix(b, a)
+}
+
+// hasGoFiles tells whether dir contains Go source files
+func hasGoFiles(dir string) bool {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" validate", flag.ExitOnError)
+	flags := newInventoryFlags(fs, true)
+	file := fs.String("file", filepath.Join("Godeps", "Godeps.json"), "Godeps.json file to validate, relative to -root")
+	goproxy := fs.String("goproxy", "", "module proxy queried for revisions missing from the module cache (defaults to $GOPROXY, \"off\" to disable)")
+	stagingCommits := fs.Bool("staging-commits", false, "expect the last commit touching each staging directory, instead of a placeholder")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+	flags.parse()
+
+	ctx, cancel := flags.context()
+	defer cancel()
+
+	fname := filepath.Join(flags.Dir, *file)
+	gd, err := LoadGodeps(fname)
+	if err == nil && gd == nil {
+		err = fmt.Errorf("%s: no such file", fname)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	inv, err := flags.load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	inv.Resolver = newResolver(*goproxy, *stagingCommits)
+
+	problems, err := inv.ValidateGodeps(ctx, gd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%s is inconsistent with go.mod:\n", *file)
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "\t"+p.String())
+		}
+		os.Exit(1)
+	}
+}
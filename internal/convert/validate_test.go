@@ -0,0 +1,97 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+func TestValidateGodeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(fname, content string) string {
+		fname = filepath.Join(dir, filepath.FromSlash(fname))
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte(content), 0644)
+		return fname
+	}
+	write("a/a.go", "package a")
+	write("a/sub/sub.go", "package sub")
+	write("a/unused/unused.go", "package unused")
+	write("a/empty/README", "")
+	goMod := write("cache/a.mod", "module example.com/a")
+	write("cache/a.info", `{"Origin":{"Hash":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}}`)
+
+	inv := NewInventory(dir, []*Module{
+		{Path: "example.com/main", Main: true, Dir: dir},
+		{Path: "example.com/a", Version: "v1.0.0", Dir: filepath.Join(dir, "a"), GoMod: goMod},
+		{Path: "example.com/b", Version: "v0.0.0-20180906233101-bbbbbbbbbbbb"},
+	})
+	inv.Resolver = &HashResolver{}
+	inv.g = dependencies.Graph{
+		"example.com/main":     {Imports: []string{"example.com/a", "example.com/a/sub", "example.com/b"}},
+		"example.com/a":        {},
+		"example.com/a/sub":    {},
+		"example.com/a/unused": {},
+		"example.com/b":        {},
+	}
+
+	gd := &Godeps{
+		Deps: []Dependency{
+			{ImportPath: "example.com/a", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "example.com/a/empty", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "example.com/a/unused", Rev: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			{ImportPath: "example.com/b", Rev: "cccccccccccccccccccccccccccccccccccccccc"},
+			{ImportPath: "example.com/c", Rev: "cccccccccccccccccccccccccccccccccccccccc"},
+		},
+	}
+
+	problems, err := inv.ValidateGodeps(context.Background(), gd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []GodepsProblem{
+		{ImportPath: "example.com/a/empty", Kind: ProblemNoPackage},
+		{ImportPath: "example.com/a/sub", Kind: ProblemMissing},
+		{ImportPath: "example.com/a/unused", Kind: ProblemStale},
+		{ImportPath: "example.com/b", Kind: ProblemRev},
+		{ImportPath: "example.com/c", Kind: ProblemStale},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for i, p := range problems {
+		if p.ImportPath != expected[i].ImportPath || p.Kind != expected[i].Kind {
+			t.Errorf("unexpected problem %v, expected %s: %s", p, expected[i].ImportPath, expected[i].Kind)
+		}
+	}
+}
+
+func TestSameRev(t *testing.T) {
+	const full = "0123456789abcdef0123456789abcdef01234567"
+	for _, tc := range []struct {
+		a, b string
+		same bool
+	}{
+		{full, full, true},
+		{"0123456", full, true},
+		{full, "0123456789ab", true},
+		{"0", full, false},
+		{"012345", full, false},
+		{"1234567", full, false},
+		{"", "", false},
+	} {
+		if sameRev(tc.a, tc.b) != tc.same {
+			t.Errorf("sameRev(%q, %q) should be %v", tc.a, tc.b, tc.same)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metaPrefixes are the prefixes of files copied along with vendored packages,
+// from their directory up to the root of their module. This is the list used
+// by `go mod vendor`.
+var metaPrefixes = []string{
+	"AUTHORS",
+	"CONTRIBUTORS",
+	"COPYLEFT",
+	"COPYING",
+	"COPYRIGHT",
+	"LEGAL",
+	"LICENSE",
+	"NOTICE",
+	"PATENTS",
+}
+
+// Vendor writes to out a vendor directory for the main module that only
+// contains the packages reachable from it, along with their license files and
+// a vendor/modules.txt matching the main go.mod. Files of the current vendor
+// directory that are no longer needed are removed. Dependencies whose vendor
+// directory is a symlink to their source are left alone.
+func (i *Inventory) Vendor(ctx context.Context, out Output) error {
+	main := i.GetMainModule()
+	goMod := main.GoMod
+	if goMod == "" {
+		goMod = filepath.Join(i.RootDir, "go.mod")
+	}
+	mf, err := parseModFile(goMod)
+	if err != nil {
+		return err
+	}
+
+	subs, err := i.getSubPackages(ctx)
+	if err != nil {
+		return err
+	}
+
+	vendorDir := filepath.Join(i.RootDir, "vendor")
+	files := make(map[string]string)
+	mods := make([]*Module, 0)
+	for _, m := range i.inv {
+		if m.Main || len(subs[m.Path]) == 0 {
+			continue
+		}
+		mods = append(mods, m)
+
+		linked, err := isLinkTo(filepath.Join(vendorDir, filepath.FromSlash(m.Path)), m.Dir)
+		if err != nil {
+			return err
+		}
+		if linked {
+			i.log().Println("keeping symlinked", m.Path)
+			continue
+		}
+
+		err = vendorFiles(files, vendorDir, m, subs[m.Path])
+		if err != nil {
+			return err
+		}
+	}
+
+	stale, err := staleVendorFiles(vendorDir, files, mods)
+	if err != nil {
+		return err
+	}
+	for _, f := range stale {
+		err = out.RemoveFile(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	dests := make([]string, 0, len(files))
+	for d := range files {
+		dests = append(dests, d)
+	}
+	sort.Strings(dests)
+	for _, d := range dests {
+		content, err := ioutil.ReadFile(files[d])
+		if err != nil {
+			return err
+		}
+		err = out.WriteFile(d, content)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.log().Println("dumping vendor/modules.txt")
+	return out.WriteFile(filepath.Join(vendorDir, "modules.txt"), i.modulesTxt(mf, subs))
+}
+
+// vendorFiles records in files the destination and source of the files to
+// vendor for packages subs of module m
+func vendorFiles(files map[string]string, vendorDir string, m *Module, subs []string) error {
+	if m.Dir == "" {
+		return fmt.Errorf("%s@%s is not in the module cache", m.Path, m.Version)
+	}
+
+	for _, sub := range subs {
+		dir := filepath.Join(m.Dir, filepath.FromSlash(sub))
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.Mode().IsRegular() || !isVendoredFile(e.Name()) {
+				continue
+			}
+			files[vendorPath(vendorDir, m.Path, sub, e.Name())] = filepath.Join(dir, e.Name())
+		}
+
+		// license files of parent directories apply to the package too
+		for sub != "" {
+			sub = path.Dir(sub)
+			if sub == "." {
+				sub = ""
+			}
+			dir := filepath.Join(m.Dir, filepath.FromSlash(sub))
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if e.Mode().IsRegular() && isMetaFile(e.Name()) {
+					files[vendorPath(vendorDir, m.Path, sub, e.Name())] = filepath.Join(dir, e.Name())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func vendorPath(vendorDir, mod, sub, name string) string {
+	return filepath.Join(vendorDir, filepath.FromSlash(path.Join(mod, sub)), name)
+}
+
+// isVendoredFile tells whether a file of a package directory belongs in
+// vendor/. Tests are never needed, anything else might be (assembly, cgo
+// sources, embedded files...)
+func isVendoredFile(name string) bool {
+	return !strings.HasSuffix(name, "_test.go") && name != "go.mod" && name != "go.sum"
+}
+
+func isMetaFile(name string) bool {
+	for _, p := range metaPrefixes {
+		if len(name) >= len(p) && strings.EqualFold(name[:len(p)], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLinkTo tells whether fname is a symlink resolving to dir
+func isLinkTo(fname, dir string) (bool, error) {
+	info, err := os.Lstat(fname)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false, err
+	}
+
+	target, err := filepath.EvalSymlinks(fname)
+	if err != nil {
+		return false, err
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	return target == dir, nil
+}
+
+// staleVendorFiles returns the files of vendorDir that are not part of the
+// new vendor directory. Symlinks of vendored modules are kept, other symlinks
+// are refused as they could redirect writes outside of vendorDir.
+func staleVendorFiles(vendorDir string, files map[string]string, mods []*Module) ([]string, error) {
+	linked := make(map[string]bool)
+	for _, m := range mods {
+		linked[filepath.Join(vendorDir, filepath.FromSlash(m.Path))] = true
+	}
+
+	stale := make([]string, 0)
+	err := filepath.Walk(vendorDir, func(fname string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && fname == vendorDir {
+			return filepath.SkipDir
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if linked[fname] {
+				return nil
+			}
+			return fmt.Errorf("unexpected symlink %s, remove it first", fname)
+		}
+		if _, ok := files[fname]; !ok && fname != filepath.Join(vendorDir, "modules.txt") {
+			stale = append(stale, fname)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// modulesTxt renders vendor/modules.txt, in the format of `go mod vendor`
+func (i *Inventory) modulesTxt(mf *modFile, subs map[string][]string) []byte {
+	explicit := make(map[string]bool)
+	for _, r := range mf.Require {
+		explicit[r.Path] = true
+	}
+	goVersions := goVersionAtLeast(mf.Go, 1, 17)
+
+	mods := make([]*Module, 0)
+	for _, m := range i.inv {
+		if !m.Main && (explicit[m.Path] || len(subs[m.Path]) > 0) {
+			mods = append(mods, m)
+		}
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].Path < mods[j].Path
+	})
+
+	var b bytes.Buffer
+	written := make(map[modVersion]bool)
+	for _, m := range mods {
+		line := "# " + m.Path + " " + m.Version
+		if m.Replace.Path != "" {
+			line += " => " + m.Replace.Path
+			if m.Replace.Version != "" {
+				line += " " + m.Replace.Version
+			}
+		}
+		fmt.Fprintln(&b, line)
+		written[modVersion{m.Path, m.Version}] = true
+
+		goVersion := ""
+		if goVersions {
+			goVersion = moduleGoVersion(m)
+		}
+		switch {
+		case explicit[m.Path] && goVersion != "":
+			fmt.Fprintf(&b, "## explicit; go %s\n", goVersion)
+		case explicit[m.Path]:
+			fmt.Fprintln(&b, "## explicit")
+		case goVersion != "":
+			fmt.Fprintf(&b, "## go %s\n", goVersion)
+		}
+
+		pkgs := append([]string(nil), subs[m.Path]...)
+		sort.Strings(pkgs)
+		for _, p := range pkgs {
+			fmt.Fprintln(&b, path.Join(m.Path, p))
+		}
+	}
+
+	// replacements that didn't apply to a vendored module version still
+	// need to be recorded, for the go command to check them
+	for _, r := range mf.Replace {
+		if written[r.Old] {
+			continue
+		}
+		line := "# " + r.Old.Path
+		if r.Old.Version != "" {
+			line += " " + r.Old.Version
+		}
+		line += " => " + r.New.Path
+		if r.New.Version != "" {
+			line += " " + r.New.Version
+		}
+		fmt.Fprintln(&b, line)
+	}
+	return b.Bytes()
+}
+
+// moduleGoVersion returns the go directive of the go.mod file of m, if any
+func moduleGoVersion(m *Module) string {
+	goMod := m.GoMod
+	if m.Replace.GoMod != "" {
+		goMod = m.Replace.GoMod
+	}
+	mf, err := parseModFile(goMod)
+	if err != nil {
+		return ""
+	}
+	return mf.Go
+}
+
+// goVersionAtLeast tells whether the go directive value v is at least
+// major.minor
+func goVersionAtLeast(v string, major, minor int) bool {
+	p := strings.SplitN(v, ".", 3)
+	if len(p) < 2 {
+		return false
+	}
+	maj, err := strconv.Atoi(p[0])
+	if err != nil {
+		return false
+	}
+	min, err := strconv.Atoi(p[1])
+	if err != nil {
+		return false
+	}
+	return maj > major || (maj == major && min >= minor)
+}
+
+func vendorMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" vendor", flag.ExitOnError)
+	flags := newInventoryFlags(fs, false)
+	dryRun := fs.Bool("dry-run", false, "print a diff of the vendor directory instead of writing it")
+	verify := fs.Bool("verify", false, "fail if the vendor directory is out of date, without writing anything")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		usageError(fs, "unexpected arguments: "+strings.Join(fs.Args(), " "))
+	}
+	if *dryRun && *verify {
+		usageError(fs, "-dry-run and -verify are mutually exclusive")
+	}
+	flags.parse()
+
+	dir := flags.Dir
+	out, check := newOutput(dir, *dryRun, *verify)
+	staged := &StagedOutput{RootDir: dir}
+	if out == nil {
+		out = staged
+	}
+
+	ctx, cancel := flags.context()
+	defer cancel()
+
+	inv, err := flags.load(ctx)
+	if err == nil {
+		err = inv.Vendor(ctx, out)
+	}
+	if err == nil && out == staged {
+		log.Println("writing vendor directory")
+		err = staged.Commit()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	exitIfStale(dir, check)
+}
@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+func TestVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(fname, content string) {
+		fname = filepath.Join(dir, filepath.FromSlash(fname))
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte(content), 0644)
+	}
+	write("main/go.mod", `module example.com/main
+
+go 1.17
+
+require (
+	example.com/a v1.0.0
+	example.com/b v1.0.0
+	example.com/unused v1.0.0
+)
+
+replace example.com/b => ./b
+`)
+	write("main/b/go.mod", "module example.com/b\n\ngo 1.16\n")
+	write("main/b/b.go", "package b")
+	write("main/vendor/example.com/old/old.go", "package old")
+	write("cache/a/LICENSE", "license")
+	write("cache/a/go.mod", "module example.com/a\n")
+	write("cache/a/a.go", "package a")
+	write("cache/a/sub/NOTICE", "notice")
+	write("cache/a/sub/pkg/pkg.go", "package pkg")
+	write("cache/a/sub/pkg/pkg_amd64.s", "")
+	write("cache/a/sub/pkg/pkg_test.go", "package pkg")
+	write("cache/a/unused/unused.go", "package unused")
+
+	root := filepath.Join(dir, "main")
+	inv := NewInventory(root, []*Module{
+		{Path: "example.com/main", Main: true, Dir: root, GoMod: filepath.Join(root, "go.mod")},
+		{Path: "example.com/a", Version: "v1.0.0", Dir: filepath.Join(dir, "cache", "a")},
+		{Path: "example.com/b", Version: "v1.0.0", Dir: filepath.Join(root, "b"), GoMod: filepath.Join(root, "b", "go.mod"), Replace: Replacement{Path: "./b", Dir: filepath.Join(root, "b")}},
+		{Path: "example.com/unused", Version: "v1.0.0"},
+	})
+	inv.g = dependencies.Graph{
+		"example.com/main":          {Imports: []string{"example.com/a/sub/pkg", "example.com/b"}},
+		"example.com/a/sub/pkg":     {Imports: []string{"example.com/a"}},
+		"example.com/a":             {},
+		"example.com/a/unused":      {},
+		"example.com/b":             {},
+		"example.com/unused/unused": {},
+	}
+
+	o := &StagedOutput{RootDir: root}
+	err = inv.Vendor(context.Background(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make([]string, 0)
+	filepath.Walk(filepath.Join(root, "vendor"), func(fname string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(root, fname)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	expected := []string{
+		"vendor/example.com/a/LICENSE",
+		"vendor/example.com/a/a.go",
+		"vendor/example.com/a/sub/NOTICE",
+		"vendor/example.com/a/sub/pkg/pkg.go",
+		"vendor/example.com/a/sub/pkg/pkg_amd64.s",
+		"vendor/example.com/b/b.go",
+		"vendor/modules.txt",
+	}
+	if strings.Join(files, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected vendor files:\n%s", strings.Join(files, "\n"))
+	}
+
+	modules, _ := ioutil.ReadFile(filepath.Join(root, "vendor", "modules.txt"))
+	expectedModules := `# example.com/a v1.0.0
+## explicit
+example.com/a
+example.com/a/sub/pkg
+# example.com/b v1.0.0 => ./b
+## explicit; go 1.16
+example.com/b
+# example.com/unused v1.0.0
+## explicit
+# example.com/b => ./b
+`
+	if string(modules) != expectedModules {
+		t.Errorf("unexpected modules.txt:\n%s", modules)
+	}
+}
@@ -2,16 +2,16 @@ package convert
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Module represents a go module
@@ -36,69 +36,153 @@ type Replacement struct {
 
 type VgoRunner struct {
 	RootDir string
+	// ModFile, if set, is used in place of RootDir/go.mod by go commands
+	ModFile string
+	// Lister computes the inventory. Defaults to running the go command.
+	Lister ModuleLister
+	// Timeout bounds the duration of each go command, if set
+	Timeout time.Duration
 	inv     *Inventory
 }
 
-func (r *VgoRunner) getCommand(name string, arg ...string) *exec.Cmd {
-	cmd := exec.Command(name, arg...)
+func (r *VgoRunner) getCommand(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, arg...)
 	cmd.Dir = r.RootDir
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, "GO111MODULE=on")
 	return cmd
 }
 
-func (r *VgoRunner) GetInventory() (*Inventory, error) {
+// GoCommandError reports the failure of a go subprocess
+type GoCommandError struct {
+	Args     []string
+	Dir      string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *GoCommandError) Error() string {
+	msg := fmt.Sprintf("%s (in %s): %v", strings.Join(e.Args, " "), e.Dir, e.Err)
+	if s := strings.TrimSpace(e.Stderr); s != "" {
+		msg += "\n" + s
+	}
+	return msg
+}
+
+func (e *GoCommandError) Unwrap() error {
+	return e.Err
+}
+
+// runGo runs a go subcommand and returns its standard output. Failures are
+// reported as *GoCommandError.
+func (r *VgoRunner) runGo(ctx context.Context, arg ...string) ([]byte, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	cmd := r.getCommand(ctx, "go", r.goArgs(arg...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		e := &GoCommandError{
+			Args:     cmd.Args,
+			Dir:      cmd.Dir,
+			ExitCode: -1,
+			Stderr:   stderr.String(),
+			Err:      err,
+		}
+		if ee, ok := err.(*exec.ExitError); ok {
+			e.ExitCode = ee.ExitCode()
+		}
+		if ctx.Err() != nil {
+			// the process got killed, say why
+			e.Err = ctx.Err()
+		}
+		return nil, e
+	}
+	return stdout.Bytes(), nil
+}
+
+// goArgs completes the arguments of a go subcommand with the runner settings.
+// Flags are inserted right after the subcommand name, before any positional
+// argument.
+func (r *VgoRunner) goArgs(arg ...string) []string {
+	if r.ModFile == "" {
+		return arg
+	}
+
+	n := 1
+	if len(arg) > 1 && arg[0] == "mod" {
+		n = 2
+	}
+	if n > len(arg) {
+		n = len(arg)
+	}
+	res := make([]string, 0, len(arg)+1)
+	res = append(res, arg[:n]...)
+	res = append(res, "-modfile="+r.ModFile)
+	return append(res, arg[n:]...)
+}
+
+func (r *VgoRunner) GetInventory(ctx context.Context) (*Inventory, error) {
 	var err error
 	if r.inv == nil {
-		r.inv, err = r.getInventory()
+		r.inv, err = r.getInventory(ctx)
 	}
 	return r.inv, err
 }
 
-func (r *VgoRunner) getInventory() (*Inventory, error) {
-	cmd := r.getCommand("go", "list", "-json", "-m", "all")
-	out, err := cmd.Output()
+func (r *VgoRunner) getInventory(ctx context.Context) (*Inventory, error) {
+	l := r.Lister
+	if l == nil {
+		l = &GoLister{
+			Timeout: r.Timeout,
+		}
+	}
+	mods, err := l.ListModules(ctx, r.RootDir, r.ModFile)
 	if err != nil {
-		log.Println("oops")
-		log.Println(string(out))
 		return nil, err
 	}
+	return NewInventory(r.RootDir, mods), nil
+}
 
-	res := make(map[string]*Module)
-	dec := json.NewDecoder(bytes.NewReader(out))
-	for {
-		var m Module
-		err := dec.Decode(&m)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
+func (r *VgoRunner) Tidy(ctx context.Context) error {
+	_, err := r.runGo(ctx, "mod", "tidy")
+	return err
+}
 
-		res[m.Path] = &m
+func (r *VgoRunner) GenVgoMod(ctx context.Context, mod string) error {
+	inv, err := r.GetInventory(ctx)
+	if err != nil {
+		return err
 	}
-	return &Inventory{
-		inv:     res,
-		RootDir: r.RootDir,
-	}, nil
-}
 
-func (r *VgoRunner) Tidy() error {
-	cmd := r.getCommand("go", "mod", "tidy")
-	return cmd.Run()
+	content, err := r.RenderVgoMod(ctx, mod)
+	if err != nil {
+		return err
+	}
+
+	thisMod := inv.GetModule(mod)
+	return (&DiskOutput{}).WriteFile(filepath.Join(thisMod.Dir, "go.mod"), content)
 }
 
-func (r *VgoRunner) GenVgoMod(mod string) error {
-	inv, err := r.GetInventory()
+// RenderVgoMod returns the content of the go.mod file for submodule mod
+func (r *VgoRunner) RenderVgoMod(ctx context.Context, mod string) ([]byte, error) {
+	inv, err := r.GetInventory(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	thisMod := inv.GetModule(mod)
 
 	subs := make([]*Module, 0)
-	for _, m := range inv.GetSubmodulesFor(mod) {
+	for _, m := range inv.GetSubmodulesFor(ctx, mod) {
 		if m == thisMod.Path {
 			continue
 		}
@@ -111,7 +195,7 @@ func (r *VgoRunner) GenVgoMod(mod string) error {
 	var b bytes.Buffer
 	modPath, err := filepath.Rel(thisMod.Dir, inv.GetMainModule().GoMod)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	fmt.Fprintln(&b, "// Generated from", modPath)
@@ -127,7 +211,7 @@ func (r *VgoRunner) GenVgoMod(mod string) error {
 	for _, m := range inv.GetSubmodules() {
 		path, err := filepath.Rel(thisMod.Dir, m.Dir)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if path == "." {
 			path = "./"
@@ -147,7 +231,7 @@ func (r *VgoRunner) GenVgoMod(mod string) error {
 	}
 	fmt.Fprintln(&b, ")")
 
-	return ioutil.WriteFile(filepath.Join(thisMod.Dir, "go.mod"), b.Bytes(), 0644)
+	return b.Bytes(), nil
 }
 
 type ModInfo struct {
@@ -155,11 +239,43 @@ type ModInfo struct {
 	Name    string
 	Short   string
 	Time    string
+	Origin  *ModOrigin `json:",omitempty"`
 }
 
+// ModOrigin is the provenance information recorded by recent go versions
+type ModOrigin struct {
+	VCS  string
+	URL  string
+	Ref  string
+	Hash string
+}
+
+// LocalHash is the placeholder revision of modules replaced by a local
+// directory
+const LocalHash = "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"
+
+// isLocal tells whether the module is replaced by a directory of the main
+// module
+func (m *Module) isLocal() bool {
+	return strings.HasPrefix(m.Replace.Path, ".")
+}
+
+// hash returns the commit hash recorded in info, if any
+func (info *ModInfo) hash() string {
+	if info.Name != "" {
+		return info.Name
+	}
+	if info.Origin != nil {
+		return info.Origin.Hash
+	}
+	return ""
+}
+
+// GetHash returns the commit hash of the module, as recorded in the module
+// cache. See HashResolver for a more thorough lookup.
 func (m *Module) GetHash() (string, error) {
-	if strings.HasPrefix(m.Replace.Path, ".") {
-		return "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", nil
+	if m.isLocal() {
+		return LocalHash, nil
 	}
 
 	modFileName := m.Replace.GoMod
@@ -182,5 +298,8 @@ func (m *Module) GetHash() (string, error) {
 		return "", err
 	}
 
-	return info.Name, nil
+	if info.hash() == "" {
+		return "", fmt.Errorf("no commit hash in %s", infoFileName)
+	}
+	return info.hash(), nil
 }
@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sigma/vgo-k8s-tools/internal/dependencies"
+)
+
+// Why returns the import chains that bring pkg into the dependencies of
+// module mod (the main module if empty): the shortest one, or all of them if
+// all is set, up to limit when positive.
+func (i *Inventory) Why(ctx context.Context, mod, pkg string, all bool, limit int) ([]dependencies.Chain, error) {
+	if mod == "" {
+		mod = i.GetMainModule().Path
+	}
+	if i.GetModule(mod) == nil {
+		return nil, fmt.Errorf("unknown module %s", mod)
+	}
+
+	g, err := i.getFullDependencyGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from := func(p string) bool {
+		m := i.moduleFor(g.PackagePath(p))
+		return m != nil && m.Path == mod
+	}
+	if all {
+		return g.AllChains(from, pkg, limit), nil
+	}
+	if c := g.ShortestChain(from, pkg); c != nil {
+		return []dependencies.Chain{c}, nil
+	}
+	return nil, nil
+}
+
+// printChain writes a chain leading to pkg one package per line, marking
+// test imports
+func printChain(w io.Writer, pkg string, c dependencies.Chain) {
+	if len(c) == 0 {
+		// pkg is part of the module itself
+		fmt.Fprintln(w, pkg)
+		return
+	}
+	for i, e := range c {
+		if i == 0 {
+			fmt.Fprintln(w, e.From)
+		}
+		if e.Test {
+			fmt.Fprintln(w, e.To, "(test)")
+		} else {
+			fmt.Fprintln(w, e.To)
+		}
+	}
+}
+
+func whyMain(args []string) {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" why", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] <import-path>\n\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	flags := newInventoryFlags(fs, true)
+	module := fs.String("module", "", "module to start from, typically a staging module (defaults to the main module)")
+	all := fs.Bool("all", false, "print all import chains instead of the shortest one")
+	limit := fs.Int("limit", 100, "maximum number of chains printed with -all, shortest first (0 for no limit)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usageError(fs, "expected a single import path")
+	}
+	pkg := fs.Arg(0)
+	flags.parse()
+
+	ctx, cancel := flags.context()
+	defer cancel()
+
+	inv, err := flags.load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	chains, err := inv.Why(ctx, *module, pkg, *all, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(chains) == 0 {
+		mod := *module
+		if mod == "" {
+			mod = inv.GetMainModule().Path
+		}
+		fmt.Printf("%s does not depend on %s\n", mod, pkg)
+		os.Exit(1)
+	}
+	// same layout as `go mod why`
+	fmt.Println("#", pkg)
+	for i, c := range chains {
+		if i > 0 {
+			fmt.Println()
+		}
+		printChain(os.Stdout, pkg, c)
+	}
+}
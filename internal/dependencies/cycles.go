@@ -0,0 +1,157 @@
+package dependencies
+
+import (
+	"sort"
+)
+
+// Cycle is a strongly connected component of a graph: a set of nodes that
+// all depend on each other, along with the package imports between them.
+type Cycle struct {
+	Nodes []string
+	Edges []Edge
+}
+
+// Collapse returns the graph of the clusters of g: cluster A imports cluster
+// B if a package of A imports a package of B. Packages outside of any
+// cluster are dropped.
+func (g Graph) Collapse(clusters Clusters) Graph {
+	res := make(Graph)
+	seen := make(map[string]map[string]bool)
+	add := func(from, to string, test bool) {
+		if from == "" || to == "" || from == to {
+			return
+		}
+		key := from
+		if test {
+			key += "\x00test"
+		}
+		if seen[key] == nil {
+			seen[key] = make(map[string]bool)
+		}
+		if seen[key][to] {
+			return
+		}
+		seen[key][to] = true
+		if test {
+			res[from].TestImports = append(res[from].TestImports, to)
+		} else {
+			res[from].Imports = append(res[from].Imports, to)
+		}
+	}
+
+	for _, pkg := range g.allPackages() {
+		if c := clusters(pkg); c != "" && res[c] == nil {
+			res[c] = &Node{
+				Imports:     make([]string, 0),
+				TestImports: make([]string, 0),
+			}
+		}
+	}
+	for _, pkg := range g.packages() {
+		for _, e := range g.edges(pkg, true) {
+			add(clusters(e.From), clusters(e.To), e.Test)
+		}
+	}
+	return res
+}
+
+// Cycles returns the import cycles of g, sorted by their first node. With
+// clusters set, cycles are computed between clusters instead of packages,
+// and their edges are the package imports that cross clusters. Test imports
+// are only considered if withTests is set.
+func (g Graph) Cycles(clusters Clusters, withTests bool) []Cycle {
+	if clusters == nil {
+		clusters = func(pkg string) string { return pkg }
+	}
+	cg := g.Collapse(clusters)
+
+	res := make([]Cycle, 0)
+	component := make(map[string]int)
+	for _, scc := range cg.components(withTests) {
+		if len(scc) == 1 {
+			// Collapse drops self-imports, so single nodes are never cycles
+			continue
+		}
+		for _, n := range scc {
+			component[n] = len(res)
+		}
+		res = append(res, Cycle{Nodes: scc})
+	}
+
+	for _, pkg := range g.packages() {
+		for _, e := range g.edges(pkg, withTests) {
+			from, to := clusters(e.From), clusters(e.To)
+			if from == "" || from == to {
+				continue
+			}
+			c, ok := component[from]
+			if !ok {
+				continue
+			}
+			if other, ok := component[to]; ok && other == c {
+				res[c].Edges = append(res[c].Edges, e)
+			}
+		}
+	}
+	return res
+}
+
+// components returns the strongly connected components of g, using Tarjan's
+// algorithm. Nodes of each component are sorted, and components are sorted
+// by their first node.
+func (g Graph) components(withTests bool) [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	res := make([][]string, 0)
+
+	var visit func(pkg string)
+	visit = func(pkg string) {
+		index[pkg] = len(index)
+		low[pkg] = index[pkg]
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+
+		for _, e := range g.edges(pkg, withTests) {
+			if _, ok := g[e.To]; !ok {
+				continue
+			}
+			if _, ok := index[e.To]; !ok {
+				visit(e.To)
+				if low[e.To] < low[pkg] {
+					low[pkg] = low[e.To]
+				}
+			} else if onStack[e.To] && index[e.To] < low[pkg] {
+				low[pkg] = index[e.To]
+			}
+		}
+
+		if low[pkg] != index[pkg] {
+			return
+		}
+		scc := make([]string, 0)
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			scc = append(scc, n)
+			if n == pkg {
+				break
+			}
+		}
+		sort.Strings(scc)
+		res = append(res, scc)
+	}
+
+	for _, pkg := range g.packages() {
+		if _, ok := index[pkg]; !ok {
+			visit(pkg)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][0] < res[j][0]
+	})
+	return res
+}
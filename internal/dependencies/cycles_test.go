@@ -0,0 +1,56 @@
+package dependencies
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCycles(t *testing.T) {
+	g := Graph{
+		"a/x": {Imports: []string{"b/y", "ext"}},
+		"b/y": {Imports: []string{"c/z"}},
+		"b/w": {Imports: []string{"a/v"}},
+		"a/v": {},
+		"c/z": {Imports: []string{"c/u"}, TestImports: []string{"b/w"}},
+		"c/u": {Imports: []string{"c/z"}},
+	}
+	module := func(pkg string) string {
+		if pkg == "ext" {
+			return ""
+		}
+		return strings.Split(pkg, "/")[0]
+	}
+
+	for _, tc := range []struct {
+		name      string
+		clusters  Clusters
+		withTests bool
+		expected  []Cycle
+	}{
+		{"packages", nil, false, []Cycle{
+			{Nodes: []string{"c/u", "c/z"}, Edges: []Edge{{"c/u", "c/z", false}, {"c/z", "c/u", false}}},
+		}},
+		{"modules", module, false, []Cycle{
+			{Nodes: []string{"a", "b"}, Edges: []Edge{{"a/x", "b/y", false}, {"b/w", "a/v", false}}},
+		}},
+		{"modules with tests", module, true, []Cycle{
+			{Nodes: []string{"a", "b", "c"}, Edges: []Edge{
+				{"a/x", "b/y", false},
+				{"b/w", "a/v", false},
+				{"b/y", "c/z", false},
+				{"c/z", "b/w", true},
+			}},
+		}},
+	} {
+		cycles := g.Cycles(tc.clusters, tc.withTests)
+		if !reflect.DeepEqual(cycles, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, cycles)
+		}
+	}
+
+	acyclic := Graph{"a": {Imports: []string{"b"}}, "b": {TestImports: []string{"c"}}}
+	if cycles := acyclic.Cycles(nil, true); len(cycles) != 0 {
+		t.Errorf("expected no cycle, got %v", cycles)
+	}
+}
@@ -17,10 +17,10 @@
 package dependencies
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"go/parser"
-	"go/token"
+	"go/build"
 	"os"
 	"path/filepath"
 	"strings"
@@ -35,7 +35,9 @@ type DepsBuilder struct {
 	LocalPackages []string
 	SkipSubdirs   []string
 	BlackList     []string
-	internal      *internalBuilder
+	// Scan selects the files whose imports are considered
+	Scan     ScanOptions
+	internal *internalBuilder
 }
 
 type MultiDepsBuilder struct {
@@ -50,16 +52,16 @@ func (b *MultiDepsBuilder) Ingest(db *DepsBuilder) {
 	b.builders = append(b.builders, db)
 }
 
-func (b *MultiDepsBuilder) GetFullDependencyGraph() (Graph, error) {
+func (b *MultiDepsBuilder) GetFullDependencyGraph(ctx context.Context) (Graph, error) {
 	graphs := make([]Graph, 0)
 	for _, b := range b.builders {
-		g, err := b.GetFullDependencyGraph()
+		g, err := b.GetFullDependencyGraph(ctx)
 		if err != nil {
 			return nil, err
 		}
 		graphs = append(graphs, g)
 	}
-	return combineGraphs(graphs)
+	return CombineGraphs(graphs)
 }
 
 type internalBuilder struct {
@@ -68,6 +70,8 @@ type internalBuilder struct {
 	BlackList     []string
 	LocalPackages map[string]interface{}
 	SkipSubdirs   map[string]interface{}
+	Contexts      []*build.Context
+	Platforms     []string
 }
 
 func (b *DepsBuilder) compile() *internalBuilder {
@@ -85,28 +89,82 @@ func (b *DepsBuilder) compile() *internalBuilder {
 		skip[d] = nil
 	}
 
+	ctxts, platforms := b.Scan.contexts()
+
 	return &internalBuilder{
 		Root:          b.Root,
 		Package:       b.Package,
 		BlackList:     b.BlackList,
 		LocalPackages: loc,
 		SkipSubdirs:   skip,
+		Contexts:      ctxts,
+		Platforms:     platforms,
 	}
 }
 
 // GetPackageDependencies gives back the list of direct dependencies for the current context
-func (b *DepsBuilder) GetPackageDependencies() ([]string, error) {
-	return b.compile().getPackageDependencies()
+func (b *DepsBuilder) GetPackageDependencies(ctx context.Context) ([]string, error) {
+	return b.compile().getPackageDependencies(ctx)
+}
+
+// Kinds of Node
+const (
+	// KindPackage is an importable package. Imports of its tests written in
+	// the same package are its TestImports.
+	KindPackage = ""
+	// KindExternalTest is the external test package of a package (files of
+	// package foo_test next to package foo), keyed by XTestNode. All its
+	// imports are test imports.
+	KindExternalTest = "xtest"
+	// KindMain is a main program. Commands are keyed by their import path,
+	// main programs sitting next to another package by MainNode.
+	KindMain = "main"
+)
+
+// XTestNode returns the key of the external test package of pkg. Unlike
+// pkg_test, it can't be the import path of a real package.
+func XTestNode(pkg string) string {
+	return pkg + " [xtest]"
+}
+
+// MainNode returns the key of a main program sitting next to package pkg
+func MainNode(pkg string) string {
+	return pkg + " [main]"
 }
 
 type Node struct {
+	Kind        string
 	Imports     []string
 	TestImports []string
+	// Platforms lists the platforms an import applies to, for imports that
+	// don't apply to all scanned platforms
+	Platforms map[string][]string
+	// TestPlatforms is the same as Platforms, for TestImports
+	TestPlatforms map[string][]string
+	// Ignored tells that all the files of the node are excluded by the
+	// ignore build tag
+	Ignored bool
 }
 
 type Graph map[string]*Node
 
-func combineGraphs(graphs []Graph) (Graph, error) {
+// PackagePath returns the import path of the directory a node was found in
+func (g Graph) PackagePath(node string) string {
+	n := g[node]
+	if n == nil {
+		return node
+	}
+	switch n.Kind {
+	case KindExternalTest:
+		return strings.TrimSuffix(node, " [xtest]")
+	case KindMain:
+		return strings.TrimSuffix(node, " [main]")
+	}
+	return node
+}
+
+// CombineGraphs merges graphs that don't share any package
+func CombineGraphs(graphs []Graph) (Graph, error) {
 	res := make(map[string]*Node)
 
 	for _, g := range graphs {
@@ -128,8 +186,10 @@ func (g Graph) Normalize(n GraphNormalizer) Graph {
 		nk := n(k)
 		if _, ok := ng[nk]; !ok {
 			ng[nk] = &Node{
+				Kind:        v.Kind,
 				Imports:     make([]string, 0),
 				TestImports: make([]string, 0),
+				Ignored:     v.Ignored,
 			}
 		}
 
@@ -140,19 +200,40 @@ func (g Graph) Normalize(n GraphNormalizer) Graph {
 		for _, i := range v.TestImports {
 			node.TestImports = append(node.TestImports, n(i))
 		}
+		for i, platforms := range v.Platforms {
+			if node.Platforms == nil {
+				node.Platforms = make(map[string][]string)
+			}
+			node.Platforms[n(i)] = platforms
+		}
+		for i, platforms := range v.TestPlatforms {
+			if node.TestPlatforms == nil {
+				node.TestPlatforms = make(map[string][]string)
+			}
+			node.TestPlatforms[n(i)] = platforms
+		}
 		ng[nk] = node
 	}
 	return ng
 }
 
+// TransitiveClosure returns the packages node depends on, directly or not,
+// including the ones its tests import. Packages missing from g are part of
+// the closure, but their own imports are unknown.
 func (g Graph) TransitiveClosure(node string) []string {
 	visited := make(map[string]bool)
 	if g[node] == nil {
-		panic("oops " + node + "\n" + fmt.Sprintf("%#v", g))
+		return []string{}
 	}
-	stack := g[node].Imports
+	// copy so that graph nodes are never modified, the graph might be shared
+	// between goroutines
+	stack := make([]string, 0, len(g[node].Imports)+len(g[node].TestImports))
+	stack = append(stack, g[node].Imports...)
 	// consider test dependencies at top-level only
 	stack = append(stack, g[node].TestImports...)
+	if xt := g[XTestNode(node)]; xt != nil && xt.Kind == KindExternalTest {
+		stack = append(stack, xt.Imports...)
+	}
 
 	for _, n := range stack {
 		visited[n] = true
@@ -164,7 +245,7 @@ func (g Graph) TransitiveClosure(node string) []string {
 
 		next := g[item]
 		if next == nil {
-			panic("oopsie " + item + "\n" + fmt.Sprintf("%#v", g))
+			continue
 		}
 		for _, n := range next.Imports {
 			if visited[n] {
@@ -184,14 +265,24 @@ func (g Graph) TransitiveClosure(node string) []string {
 	return res
 }
 
+// RecursiveTransitiveClosure returns the packages outside of node that node
+// and its subpackages depend on. Main programs sitting next to a package and
+// nodes excluded by the ignore build tag are left out, as they aren't part of
+// any build, unless node is one of them.
 func (g Graph) RecursiveTransitiveClosure(node string) []string {
 	closure := make(map[string]interface{})
 
-	for n, _ := range g {
-		if n == node || strings.HasPrefix(n, node+"/") {
-			for _, item := range g.TransitiveClosure(n) {
-				closure[item] = nil
-			}
+	for n, v := range g {
+		p := g.PackagePath(n)
+		switch {
+		case n == node:
+		case v.Ignored, v.Kind == KindMain && n != p:
+			continue
+		case p != node && !strings.HasPrefix(p, node+"/"):
+			continue
+		}
+		for _, item := range g.TransitiveClosure(n) {
+			closure[item] = nil
 		}
 	}
 
@@ -204,16 +295,19 @@ func (g Graph) RecursiveTransitiveClosure(node string) []string {
 	return res
 }
 
-func (b *DepsBuilder) GetFullDependencyGraph() (Graph, error) {
-	return b.compile().getFullDependencyGraph()
+func (b *DepsBuilder) GetFullDependencyGraph(ctx context.Context) (Graph, error) {
+	return b.compile().getFullDependencyGraph(ctx)
 }
 
-func (b *internalBuilder) getFullDependencyGraph() (Graph, error) {
+func (b *internalBuilder) getFullDependencyGraph(ctx context.Context) (Graph, error) {
 	dirs := make([]string, 0)
 	filepath.Walk(b.Root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		if info == nil || !info.IsDir() {
 			return nil
@@ -252,27 +346,39 @@ MAINLOOP:
 
 		m[d] = filepath.Join(b.Package, d)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	g := make(map[string]*Node)
 	for k, v := range m {
-		subdeps, err := b.packageAllDeps(filepath.Join(b.Root, k))
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		nodes, err := b.packageAllDeps(filepath.Join(b.Root, k), v)
 
 		if err != nil {
 			continue
 		}
 
-		g[v] = subdeps
+		for key, n := range nodes {
+			g[key] = n
+		}
 	}
 
 	return Graph(g), nil
 }
 
-func (b *internalBuilder) getPackageDependencies() ([]string, error) {
+func (b *internalBuilder) getPackageDependencies(ctx context.Context) ([]string, error) {
 	deps := make(map[string]interface{})
 
 	err := filepath.Walk(b.Root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		if info == nil || !info.IsDir() {
 			return nil
@@ -313,17 +419,14 @@ func (b *internalBuilder) getPackageDependencies() ([]string, error) {
 func (b *internalBuilder) packageDeps(pack string) (map[string]interface{}, error) {
 	depsMap := make(map[string]interface{})
 
-	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, pack, nil, parser.ImportsOnly)
+	pkgs, err := scanDir(pack, b.Contexts)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, p := range pkgs {
-		for _, f := range p.Files {
-			for _, i := range f.Imports {
-				d := i.Path.Value
-				d = d[1 : len(d)-1] // remove quotes
+	for _, files := range pkgs {
+		for _, f := range files {
+			for _, d := range f.imports {
 				if b.isExternalDependency(d) {
 					depsMap[d] = nil
 				}
@@ -334,39 +437,80 @@ func (b *internalBuilder) packageDeps(pack string) (map[string]interface{}, erro
 	return depsMap, nil
 }
 
-func (b *internalBuilder) packageAllDeps(pack string) (*Node, error) {
-	depsMap := make(map[string]interface{})
-	testDepsMap := make(map[string]interface{})
-
-	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, pack, nil, parser.ImportsOnly)
+// packageAllDeps returns the nodes found in directory pack, whose import
+// path is pkg: the package itself, its external tests and a main program
+// sitting next to it, if any
+func (b *internalBuilder) packageAllDeps(pack, pkg string) (Graph, error) {
+	pkgs, err := scanDir(pack, b.Contexts)
 	if err != nil {
-		return &Node{}, err
+		return nil, err
 	}
 
 	if len(pkgs) == 0 {
-		return &Node{}, fmt.Errorf("not a go package")
+		return nil, fmt.Errorf("not a go package")
 	}
 
-	for _, p := range pkgs {
-		// TODO(yhodique): that's a gross hack that kinda works only because
-		// we're interested only in importable stuff for now.
-		if p.Name == "main" && len(pkgs) > 1 {
-			continue
+	// split files between the package, its external tests and main
+	var lib, xtest, main []*scannedFile
+	for name, files := range pkgs {
+		for _, f := range files {
+			switch {
+			case strings.HasSuffix(name, "_test") && strings.HasSuffix(f.name, "_test.go"):
+				xtest = append(xtest, f)
+			case name == "main":
+				main = append(main, f)
+			default:
+				lib = append(lib, f)
+			}
 		}
-		for fname, f := range p.Files {
-			for _, i := range f.Imports {
-				d := i.Path.Value
-				d = d[1 : len(d)-1] // remove quotes
-				if b.isBlacklisted(d) {
-					continue
+	}
+
+	g := make(Graph)
+	switch {
+	case lib != nil:
+		g[pkg] = b.node(KindPackage, lib)
+		if main != nil {
+			g[MainNode(pkg)] = b.node(KindMain, main)
+		}
+	case main != nil:
+		g[pkg] = b.node(KindMain, main)
+	}
+	if xtest != nil {
+		g[XTestNode(pkg)] = b.node(KindExternalTest, xtest)
+	}
+	return g, nil
+}
+
+// node returns a node of the given kind importing what files do
+func (b *internalBuilder) node(kind string, files []*scannedFile) *Node {
+	depsMap := make(map[string]interface{})
+	testDepsMap := make(map[string]interface{})
+
+	// platforms of each import, by index in b.Contexts. Test files don't
+	// bring platforms to regular imports, and the other way around.
+	platforms := make(map[string]map[int]bool)
+	testPlatforms := make(map[string]map[int]bool)
+
+	for _, f := range files {
+		for _, d := range f.imports {
+			if b.isBlacklisted(d) {
+				continue
+			}
+			if !b.isStandardDependency(d) {
+				// imports of external tests are recorded as regular ones,
+				// the node kind tells they are test imports
+				ps := platforms
+				if kind != KindExternalTest && strings.HasSuffix(f.name, "_test.go") {
+					testDepsMap[d] = nil
+					ps = testPlatforms
+				} else {
+					depsMap[d] = nil
 				}
-				if !b.isStandardDependency(d) {
-					if strings.HasSuffix(fname, "_test.go") {
-						testDepsMap[d] = nil
-					} else {
-						depsMap[d] = nil
-					}
+				if ps[d] == nil {
+					ps[d] = make(map[int]bool)
+				}
+				for _, p := range f.platforms {
+					ps[d][p] = true
 				}
 			}
 		}
@@ -385,10 +529,42 @@ func (b *internalBuilder) packageAllDeps(pack string) (*Node, error) {
 		testRes = append(testRes, k)
 	}
 
-	return &Node{
+	n := &Node{
+		Kind:        kind,
 		Imports:     res,
 		TestImports: testRes,
-	}, nil
+		Ignored:     len(files) > 0,
+	}
+	for _, f := range files {
+		n.Ignored = n.Ignored && f.ignored
+	}
+	n.Platforms = b.partialPlatforms(platforms, res)
+	n.TestPlatforms = b.partialPlatforms(testPlatforms, testRes)
+	return n
+}
+
+// partialPlatforms returns the names of the platforms of the imports that
+// don't apply to all of them, or nil
+func (b *internalBuilder) partialPlatforms(platforms map[string]map[int]bool, imports []string) map[string][]string {
+	if len(b.Contexts) <= 1 {
+		return nil
+	}
+	var res map[string][]string
+	for _, d := range imports {
+		ps := platforms[d]
+		if len(ps) == len(b.Contexts) {
+			continue
+		}
+		if res == nil {
+			res = make(map[string][]string)
+		}
+		for i, name := range b.Platforms {
+			if ps[i] {
+				res[d] = append(res[d], name)
+			}
+		}
+	}
+	return res
 }
 
 func (b *internalBuilder) isStandardDependency(pack string) bool {
@@ -1,6 +1,12 @@
 package dependencies
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -34,3 +40,86 @@ func TestGraphNormalization(t *testing.T) {
 		t.Error("not Baz")
 	}
 }
+
+func TestNodeKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"lib/lib.go":      "package lib\n\nimport _ \"example.com/dep\"\n",
+		"lib/lib_test.go": "package lib\n\nimport _ \"example.com/testdep\"\n",
+		"lib/x_test.go":   "package lib_test\n\nimport _ \"example.com/root/lib\"\nimport _ \"example.com/xtestdep\"\n",
+		"lib/gen.go":      "// +build ignore\n\npackage main\n\nimport _ \"example.com/tool\"\n",
+		"gen/gen.go":      "//go:build ignore\n\npackage main\n\nimport _ \"example.com/gentool\"\n",
+		"cmd/main.go":     "package main\n\nimport _ \"example.com/root/lib\"\n",
+		// a real package whose import path looks like an external test
+		"lib_test/sibling.go": "package lib_test\n\nimport _ \"example.com/sibling\"\n",
+		"only/x_test.go":      "package only_test\n\nimport _ \"example.com/root/lib\"\n",
+		"x_test.go":           "package root_test\n\nimport _ \"example.com/rootxtest\"\n",
+		"root.go":             "package root\n",
+	} {
+		fname := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte(content), 0644)
+	}
+
+	g, err := (&DepsBuilder{
+		Root:    dir,
+		Package: "example.com/root",
+	}).GetFullDependencyGraph(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]struct {
+		kind    string
+		imports []string
+		tests   []string
+	}{
+		"example.com/root":              {KindPackage, []string{}, []string{}},
+		"example.com/root [xtest]":      {KindExternalTest, []string{"example.com/rootxtest"}, []string{}},
+		"example.com/root/lib":          {KindPackage, []string{"example.com/dep"}, []string{"example.com/testdep"}},
+		"example.com/root/lib [xtest]":  {KindExternalTest, []string{"example.com/root/lib", "example.com/xtestdep"}, []string{}},
+		"example.com/root/lib [main]":   {KindMain, []string{"example.com/tool"}, []string{}},
+		"example.com/root/cmd":          {KindMain, []string{"example.com/root/lib"}, []string{}},
+		"example.com/root/lib_test":     {KindPackage, []string{"example.com/sibling"}, []string{}},
+		"example.com/root/only [xtest]": {KindExternalTest, []string{"example.com/root/lib"}, []string{}},
+	} {
+		n := g[key]
+		if n == nil {
+			t.Errorf("%s: not found", key)
+			continue
+		}
+		sort.Strings(n.Imports)
+		if n.Kind != expected.kind || !reflect.DeepEqual(n.Imports, expected.imports) || !reflect.DeepEqual(n.TestImports, expected.tests) {
+			t.Errorf("%s: expected %v, got %+v", key, expected, n)
+		}
+	}
+	if g["example.com/root/only"] != nil {
+		t.Error("unexpected node for a directory without package")
+	}
+
+	if p := g.PackagePath("example.com/root/lib [main]"); p != "example.com/root/lib" {
+		t.Errorf("unexpected package path %s", p)
+	}
+
+	if !g["example.com/root/lib [main]"].Ignored || !g["example.com/root/gen"].Ignored || g["example.com/root/cmd"].Ignored {
+		t.Error("unexpected ignored nodes")
+	}
+
+	// generators are left out unless asked for
+	for node, expected := range map[string][]string{
+		"example.com/root":            {"example.com/dep", "example.com/rootxtest", "example.com/sibling", "example.com/testdep", "example.com/xtestdep"},
+		"example.com/root/lib [main]": {"example.com/tool"},
+		"example.com/root/gen":        {"example.com/gentool"},
+	} {
+		clos := g.RecursiveTransitiveClosure(node)
+		sort.Strings(clos)
+		if !reflect.DeepEqual(clos, expected) {
+			t.Errorf("%s: expected closure %v, got %v", node, expected, clos)
+		}
+	}
+}
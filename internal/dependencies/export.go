@@ -0,0 +1,296 @@
+package dependencies
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Clusters maps packages to the group they belong to, typically their
+// module. Packages outside of any group map to "".
+type Clusters func(pkg string) string
+
+// JSONVersion is the version of the JSON schema written by WriteJSON.
+// Version 2 introduced node kinds, keys of external tests and main programs
+// that aren't import paths, and per-platform test imports.
+const JSONVersion = 2
+
+// jsonGraph is the JSON form of a graph. Packages and their imports are
+// sorted, so that documents can be diffed.
+type jsonGraph struct {
+	Version  int
+	Packages []jsonPackage
+}
+
+type jsonPackage struct {
+	Path        string
+	Kind        string   `json:",omitempty"`
+	Module      string   `json:",omitempty"`
+	Imports     []string `json:",omitempty"`
+	TestImports []string `json:",omitempty"`
+	// Platforms lists the platforms of imports that don't apply to all of
+	// them
+	Platforms map[string][]string `json:",omitempty"`
+	// TestPlatforms is the same as Platforms, for test imports
+	TestPlatforms map[string][]string `json:",omitempty"`
+	Ignored       bool                `json:",omitempty"`
+}
+
+// packages returns the packages of g, sorted
+func (g Graph) packages() []string {
+	res := make([]string, 0, len(g))
+	for pkg := range g {
+		res = append(res, pkg)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// allPackages returns the packages of g along with the ones they import,
+// sorted
+func (g Graph) allPackages() []string {
+	seen := make(map[string]bool)
+	for pkg, n := range g {
+		seen[pkg] = true
+		for _, i := range n.Imports {
+			seen[i] = true
+		}
+		for _, i := range n.TestImports {
+			seen[i] = true
+		}
+	}
+	res := make([]string, 0, len(seen))
+	for pkg := range seen {
+		res = append(res, pkg)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func sorted(l []string) []string {
+	res := append([]string(nil), l...)
+	sort.Strings(res)
+	return res
+}
+
+// WriteJSON writes g in a stable JSON form, that ReadJSON loads back.
+// clusters, if not nil, records the module of each package.
+func (g Graph) WriteJSON(w io.Writer, clusters Clusters) error {
+	doc := jsonGraph{
+		Version:  JSONVersion,
+		Packages: make([]jsonPackage, 0, len(g)),
+	}
+	for _, pkg := range g.packages() {
+		p := jsonPackage{
+			Path:          pkg,
+			Kind:          g[pkg].Kind,
+			Imports:       sorted(g[pkg].Imports),
+			TestImports:   sorted(g[pkg].TestImports),
+			Platforms:     g[pkg].Platforms,
+			TestPlatforms: g[pkg].TestPlatforms,
+			Ignored:       g[pkg].Ignored,
+		}
+		if clusters != nil {
+			p.Module = clusters(pkg)
+		}
+		doc.Packages = append(doc.Packages, p)
+	}
+
+	js, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(js, '\n'))
+	return err
+}
+
+// ReadJSON loads a graph written by WriteJSON, along with the module of each
+// package, if recorded
+func ReadJSON(r io.Reader) (Graph, map[string]string, error) {
+	var doc jsonGraph
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case doc.Version < JSONVersion:
+		// older graphs mix up tests and main programs with packages
+		return nil, nil, fmt.Errorf("graph version %d is obsolete, regenerate it", doc.Version)
+	case doc.Version > JSONVersion:
+		return nil, nil, fmt.Errorf("unsupported graph version %d", doc.Version)
+	}
+
+	g := make(Graph)
+	modules := make(map[string]string)
+	for _, p := range doc.Packages {
+		if _, ok := g[p.Path]; ok {
+			return nil, nil, fmt.Errorf("duplicate package %s", p.Path)
+		}
+		n := &Node{
+			Kind:          p.Kind,
+			Imports:       p.Imports,
+			TestImports:   p.TestImports,
+			Platforms:     p.Platforms,
+			TestPlatforms: p.TestPlatforms,
+			Ignored:       p.Ignored,
+		}
+		if n.Imports == nil {
+			n.Imports = make([]string, 0)
+		}
+		if n.TestImports == nil {
+			n.TestImports = make([]string, 0)
+		}
+		g[p.Path] = n
+		if p.Module != "" {
+			modules[p.Path] = p.Module
+		}
+	}
+	return g, modules, nil
+}
+
+// platforms returns the platforms e applies to, joined, or "" for all of them
+func (g Graph) platforms(e Edge) string {
+	n := g[e.From]
+	// external tests only have regular imports
+	if e.Test && n.Kind != KindExternalTest {
+		return strings.Join(n.TestPlatforms[e.To], ",")
+	}
+	return strings.Join(n.Platforms[e.To], ",")
+}
+
+// kind returns the kind of node pkg, packages being imported without being
+// part of g included
+func (g Graph) kind(pkg string) string {
+	if n := g[pkg]; n != nil {
+		return n.Kind
+	}
+	return KindPackage
+}
+
+var dotNodeAttrs = map[string]string{
+	KindExternalTest: " [style=dashed]",
+	KindMain:         " [shape=ellipse]",
+}
+
+// WriteDOT writes g in the Graphviz format. Packages of the same cluster are
+// drawn together, test imports and external test packages are dashed, main
+// programs are ellipses and platform-specific imports are labeled with their
+// platforms.
+func (g Graph) WriteDOT(w io.Writer, clusters Clusters) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph dependencies {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	groups := make(map[string][]string)
+	for _, pkg := range g.allPackages() {
+		c := ""
+		if clusters != nil {
+			c = clusters(pkg)
+		}
+		groups[c] = append(groups[c], pkg)
+	}
+	names := make([]string, 0, len(groups))
+	for c := range groups {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+
+	for i, c := range names {
+		indent := "\t"
+		if c != "" {
+			fmt.Fprintf(bw, "\tsubgraph %s {\n", strconv.Quote(fmt.Sprintf("cluster_%d", i)))
+			fmt.Fprintf(bw, "\t\tlabel=%s;\n", strconv.Quote(c))
+			indent = "\t\t"
+		}
+		for _, pkg := range groups[c] {
+			fmt.Fprintf(bw, "%s%s%s;\n", indent, strconv.Quote(pkg), dotNodeAttrs[g.kind(pkg)])
+		}
+		if c != "" {
+			fmt.Fprintln(bw, "\t}")
+		}
+	}
+
+	for _, pkg := range g.packages() {
+		for _, e := range g.edges(pkg, true) {
+			attrs := make([]string, 0)
+			if e.Test {
+				attrs = append(attrs, "style=dashed")
+			}
+			if p := g.platforms(e); p != "" {
+				attrs = append(attrs, "label="+strconv.Quote(p))
+			}
+			a := ""
+			if len(attrs) > 0 {
+				a = " [" + strings.Join(attrs, ", ") + "]"
+			}
+			fmt.Fprintf(bw, "\t%s -> %s%s;\n", strconv.Quote(e.From), strconv.Quote(e.To), a)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteGraphML writes g in the GraphML format. Clusters are recorded as the
+// "module" attribute of nodes along with their "kind", test imports and
+// platforms as the "test" and "platforms" attributes of edges.
+func (g Graph) WriteGraphML(w io.Writer, clusters Clusters) error {
+	bw := bufio.NewWriter(w)
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	fmt.Fprint(bw, xml.Header)
+	fmt.Fprintln(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(bw, `  <key id="module" for="node" attr.name="module" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="kind" for="node" attr.name="kind" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <key id="test" for="edge" attr.name="test" attr.type="boolean"><default>false</default></key>`)
+	fmt.Fprintln(bw, `  <key id="platforms" for="edge" attr.name="platforms" attr.type="string"/>`)
+	fmt.Fprintln(bw, `  <graph id="dependencies" edgedefault="directed">`)
+
+	for _, pkg := range g.allPackages() {
+		c := ""
+		if clusters != nil {
+			c = clusters(pkg)
+		}
+		data := ""
+		if c != "" {
+			data += `<data key="module">` + esc(c) + `</data>`
+		}
+		if k := g.kind(pkg); k != KindPackage {
+			data += `<data key="kind">` + k + `</data>`
+		}
+		if data == "" {
+			fmt.Fprintf(bw, "    <node id=\"%s\"/>\n", esc(pkg))
+			continue
+		}
+		fmt.Fprintf(bw, "    <node id=\"%s\">%s</node>\n", esc(pkg), data)
+	}
+
+	for _, pkg := range g.packages() {
+		for _, e := range g.edges(pkg, true) {
+			data := ""
+			if e.Test {
+				data += `<data key="test">true</data>`
+			}
+			if p := g.platforms(e); p != "" {
+				data += `<data key="platforms">` + esc(p) + `</data>`
+			}
+			if data == "" {
+				fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\"/>\n", esc(e.From), esc(e.To))
+				continue
+			}
+			fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\">%s</edge>\n", esc(e.From), esc(e.To), data)
+		}
+	}
+
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+	return bw.Flush()
+}
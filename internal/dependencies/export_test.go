@@ -0,0 +1,139 @@
+package dependencies
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportGraph() (Graph, Clusters) {
+	g := Graph{
+		"main": {
+			Imports:       []string{"lib/b", "lib/a"},
+			TestImports:   []string{"t"},
+			Platforms:     map[string][]string{"lib/b": {"linux/amd64"}},
+			TestPlatforms: map[string][]string{"t": {"windows/amd64"}},
+		},
+		"lib/a":  {Imports: []string{"lib/b"}, TestImports: []string{}},
+		"lib/b":  {Imports: []string{"ext"}, TestImports: []string{}},
+		"t":      {Imports: []string{}, TestImports: []string{}},
+		"a&<\"b": {Imports: []string{}, TestImports: []string{}},
+	}
+	clusters := func(pkg string) string {
+		if strings.HasPrefix(pkg, "lib/") {
+			return "lib"
+		}
+		if pkg == "main" {
+			return "main"
+		}
+		return ""
+	}
+	return g, clusters
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	g, clusters := exportGraph()
+
+	var b bytes.Buffer
+	if err := g.WriteJSON(&b, clusters); err != nil {
+		t.Fatal(err)
+	}
+	js := b.String()
+	if !strings.Contains(js, `"Imports": [
+				"lib/a",
+				"lib/b"
+			]`) {
+		t.Errorf("expected sorted imports, got:\n%s", js)
+	}
+
+	loaded, modules, err := ReadJSON(strings.NewReader(js))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g["main"].Imports = []string{"lib/a", "lib/b"}
+	if !reflect.DeepEqual(g, loaded) {
+		t.Errorf("expected %v, got %v", g, loaded)
+	}
+	expected := map[string]string{"main": "main", "lib/a": "lib", "lib/b": "lib"}
+	if !reflect.DeepEqual(modules, expected) {
+		t.Errorf("expected modules %v, got %v", expected, modules)
+	}
+
+	var again bytes.Buffer
+	loaded.WriteJSON(&again, func(pkg string) string { return modules[pkg] })
+	if again.String() != js {
+		t.Errorf("output not stable:\n%s\n---\n%s", js, again.String())
+	}
+
+	for _, v := range []string{"1", "42"} {
+		if _, _, err := ReadJSON(strings.NewReader(`{"Version": ` + v + `}`)); err == nil {
+			t.Errorf("expected an error for version %s", v)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g, clusters := exportGraph()
+
+	var b bytes.Buffer
+	if err := g.WriteDOT(&b, clusters); err != nil {
+		t.Fatal(err)
+	}
+	dot := b.String()
+	for _, s := range []string{
+		"subgraph \"cluster_1\" {\n\t\tlabel=\"lib\";\n\t\t\"lib/a\";\n\t\t\"lib/b\";\n\t}",
+		"\t\"ext\";\n",
+		"\t\"a&<\\\"b\";\n",
+		"\t\"lib/b\" -> \"ext\";\n",
+		"\t\"main\" -> \"lib/b\" [label=\"linux/amd64\"];\n",
+		"\t\"main\" -> \"t\" [style=dashed, label=\"windows/amd64\"];\n",
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("expected %q in:\n%s", s, dot)
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	g, clusters := exportGraph()
+
+	var b bytes.Buffer
+	if err := g.WriteGraphML(&b, clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Nodes []struct {
+			ID   string `xml:"id,attr"`
+			Data string `xml:"data"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string   `xml:"source,attr"`
+			Target string   `xml:"target,attr"`
+			Data   []string `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("%v:\n%s", err, b.String())
+	}
+
+	nodes := make(map[string]string)
+	for _, n := range doc.Nodes {
+		nodes[n.ID] = n.Data
+	}
+	expected := map[string]string{"main": "main", "lib/a": "lib", "lib/b": "lib", "t": "", "ext": "", "a&<\"b": ""}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected nodes %v, got %v", expected, nodes)
+	}
+
+	edges := make([]string, 0)
+	for _, e := range doc.Edges {
+		edges = append(edges, e.Source+">"+e.Target+":"+strings.Join(e.Data, ","))
+	}
+	expectedEdges := []string{"lib/a>lib/b:", "lib/b>ext:", "main>lib/a:", "main>lib/b:linux/amd64", "main>t:true,windows/amd64"}
+	if !reflect.DeepEqual(edges, expectedEdges) {
+		t.Errorf("expected edges %v, got %v", expectedEdges, edges)
+	}
+}
@@ -0,0 +1,211 @@
+package dependencies
+
+import (
+	"sort"
+)
+
+// Edge is an import of package To by package From. Test is set when the
+// import only comes from test files.
+type Edge struct {
+	From string
+	To   string
+	Test bool
+}
+
+// Chain is a sequence of imports, each one starting where the previous one
+// ends
+type Chain []Edge
+
+// edges returns the imports of pkg, in a stable order. As for
+// TransitiveClosure, test imports are only followed from the packages we
+// start from. All imports of external test packages are test imports.
+func (g Graph) edges(pkg string, withTests bool) []Edge {
+	n := g[pkg]
+	if n == nil {
+		return nil
+	}
+
+	res := make([]Edge, 0, len(n.Imports)+len(n.TestImports))
+	xtest := n.Kind == KindExternalTest
+	if xtest && !withTests {
+		return res
+	}
+	imports := append([]string(nil), n.Imports...)
+	sort.Strings(imports)
+	for _, i := range imports {
+		res = append(res, Edge{From: pkg, To: i, Test: xtest})
+	}
+	if withTests {
+		tests := append([]string(nil), n.TestImports...)
+		sort.Strings(tests)
+		for _, i := range tests {
+			res = append(res, Edge{From: pkg, To: i, Test: true})
+		}
+	}
+	return res
+}
+
+// sortedSources returns the packages of g that match from, sorted
+func (g Graph) sortedSources(from func(pkg string) bool) []string {
+	res := make([]string, 0)
+	for pkg := range g {
+		if from(pkg) {
+			res = append(res, pkg)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ShortestChain returns one of the shortest import chains leading from a
+// package matching from to target, or nil if target isn't reachable. Chains
+// don't go through other matching packages: they start at the last one.
+// Regular imports are preferred over test ones. The chain is empty if target
+// matches from itself.
+func (g Graph) ShortestChain(from func(pkg string) bool, target string) Chain {
+	if from(target) {
+		return Chain{}
+	}
+	sources := g.sortedSources(from)
+	prev := make(map[string]Edge)
+	visited := make(map[string]bool)
+	for _, s := range sources {
+		visited[s] = true
+	}
+
+	queue := make([]string, 0)
+	for _, withTests := range []bool{false, true} {
+		for _, s := range sources {
+			for _, e := range g.edges(s, true) {
+				if e.Test != withTests || visited[e.To] {
+					continue
+				}
+				visited[e.To] = true
+				prev[e.To] = e
+				queue = append(queue, e.To)
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		if _, ok := prev[target]; ok {
+			break
+		}
+		item := queue[0]
+		queue = queue[1:]
+		for _, e := range g.edges(item, false) {
+			if visited[e.To] {
+				continue
+			}
+			visited[e.To] = true
+			prev[e.To] = e
+			queue = append(queue, e.To)
+		}
+	}
+
+	e, ok := prev[target]
+	if !ok {
+		return nil
+	}
+	chain := Chain{e}
+	for !from(e.From) {
+		e = prev[e.From]
+		chain = append(chain, e)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// AllChains returns the import chains without cycles leading from a package
+// matching from to target, shortest first. Chains don't go through other
+// matching packages. At most limit chains are returned, if limit is positive:
+// the shortest ones. A single empty chain is returned if target matches from
+// itself.
+func (g Graph) AllChains(from func(pkg string) bool, target string, limit int) []Chain {
+	if from(target) {
+		return []Chain{{}}
+	}
+	// only explore packages that lead to target
+	leads := g.reaching(target)
+	sources := g.sortedSources(from)
+
+	res := make([]Chain, 0)
+	onPath := make(map[string]bool)
+	// chains are enumerated by increasing length, so that the limit keeps
+	// the shortest ones. truncated tells whether longer chains might exist.
+	var depth int
+	var truncated bool
+	var walk func(pkg string, chain Chain, withTests bool) bool
+	walk = func(pkg string, chain Chain, withTests bool) bool {
+		onPath[pkg] = true
+		defer delete(onPath, pkg)
+
+		for _, e := range g.edges(pkg, withTests) {
+			if onPath[e.To] || from(e.To) || !leads[e.To] {
+				continue
+			}
+			c := append(chain[:len(chain):len(chain)], e)
+			if e.To == target {
+				if len(c) < depth {
+					// found at a previous depth
+					continue
+				}
+				res = append(res, c)
+				if limit > 0 && len(res) >= limit {
+					return false
+				}
+				continue
+			}
+			if len(c) == depth {
+				truncated = true
+				continue
+			}
+			if !walk(e.To, c, false) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for depth = 1; ; depth++ {
+		truncated = false
+		for _, s := range sources {
+			if !walk(s, nil, true) {
+				return res
+			}
+		}
+		if !truncated {
+			return res
+		}
+	}
+}
+
+// reaching returns the packages from which target can be reached, including
+// target itself
+func (g Graph) reaching(target string) map[string]bool {
+	importers := make(map[string][]string)
+	for pkg, n := range g {
+		for _, i := range n.Imports {
+			importers[i] = append(importers[i], pkg)
+		}
+		for _, i := range n.TestImports {
+			importers[i] = append(importers[i], pkg)
+		}
+	}
+
+	res := map[string]bool{target: true}
+	stack := []string{target}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, i := range importers[item] {
+			if !res[i] {
+				res[i] = true
+				stack = append(stack, i)
+			}
+		}
+	}
+	return res
+}
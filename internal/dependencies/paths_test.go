@@ -0,0 +1,75 @@
+package dependencies
+
+import (
+	"strings"
+	"testing"
+)
+
+func chainString(c Chain) string {
+	parts := make([]string, 0, len(c)+1)
+	for i, e := range c {
+		if i == 0 {
+			parts = append(parts, e.From)
+		}
+		arrow := "->"
+		if e.Test {
+			arrow = "-test->"
+		}
+		parts = append(parts, arrow, e.To)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestChains(t *testing.T) {
+	g := Graph{
+		"main":     {Imports: []string{"main/sub", "a"}, TestImports: []string{"t"}},
+		"main/sub": {Imports: []string{"b"}},
+		"a":        {Imports: []string{"b", "c"}},
+		"b":        {Imports: []string{"c", "missing"}, TestImports: []string{"x"}},
+		"c":        {},
+		"t":        {Imports: []string{"x"}},
+		"x":        {},
+	}
+	isMain := func(pkg string) bool {
+		return pkg == "main" || strings.HasPrefix(pkg, "main/")
+	}
+
+	for target, expected := range map[string]string{
+		"c":    "main -> a -> c",
+		"b":    "main/sub -> b",
+		"x":    "main -test-> t -> x",
+		"nope": "",
+	} {
+		if got := chainString(g.ShortestChain(isMain, target)); got != expected {
+			t.Errorf("%s: expected %q, got %q", target, expected, got)
+		}
+	}
+
+	all := g.AllChains(isMain, "c", 0)
+	expected := []string{
+		"main -> a -> c",
+		"main/sub -> b -> c",
+		"main -> a -> b -> c",
+	}
+	if len(all) != len(expected) {
+		t.Fatalf("unexpected chains: %v", all)
+	}
+	for i, c := range all {
+		if got := chainString(c); got != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], got)
+		}
+	}
+
+	// the limit keeps the shortest chains, even if longer ones come first
+	if limited := g.AllChains(isMain, "c", 1); len(limited) != 1 || chainString(limited[0]) != expected[0] {
+		t.Errorf("expected %q only, got %v", expected[0], limited)
+	}
+
+	// packages of the source have an empty chain
+	if c := g.ShortestChain(isMain, "main/sub"); c == nil || len(c) != 0 {
+		t.Errorf("expected an empty chain, got %v", c)
+	}
+	if all := g.AllChains(isMain, "main/sub", 0); len(all) != 1 || len(all[0]) != 0 {
+		t.Errorf("expected a single empty chain, got %v", all)
+	}
+}
@@ -0,0 +1,224 @@
+package dependencies
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scopes of a Rule
+const (
+	// ScopeAll applies a rule to all imports
+	ScopeAll = ""
+	// ScopeTest applies a rule to the imports of tests only
+	ScopeTest = "test"
+	// ScopeNonTest applies a rule to the imports of non-test code only
+	ScopeNonTest = "nontest"
+)
+
+// Rule restricts the imports of the packages under Selector. Imports
+// matching one of ForbiddenPrefixes are rejected, as well as imports matching
+// none of AllowedPrefixes when it isn't empty. Prefixes match whole path
+// elements.
+type Rule struct {
+	Selector          string
+	AllowedPrefixes   []string `json:",omitempty"`
+	ForbiddenPrefixes []string `json:",omitempty"`
+	Scope             string   `json:",omitempty"`
+
+	// Source is the file the rule was loaded from, if any
+	Source string `json:"-"`
+}
+
+// Policy is a set of rules, all of which must be satisfied
+type Policy struct {
+	Rules []*Rule
+}
+
+// Violation is an import that breaks a rule. Position locates the import,
+// when the sources of the importing package could be found.
+type Violation struct {
+	Rule     *Rule
+	Edge     Edge
+	Reason   string
+	Position token.Position
+}
+
+func (v *Violation) String() string {
+	msg := fmt.Sprintf("%s imports %s: %s", v.Edge.From, v.Edge.To, v.Reason)
+	if v.Rule.Source != "" {
+		msg += " (rule from " + v.Rule.Source + ")"
+	}
+	if v.Position.IsValid() {
+		return v.Position.String() + ": " + msg
+	}
+	return msg
+}
+
+// LoadPolicy reads a policy file. Rules without a selector select
+// defaultSelector, which is typically the package of the directory holding
+// the file. Without one, rules must have a selector. Unknown fields are
+// rejected, so that files of other tools aren't mistaken for policies.
+func LoadPolicy(fname, defaultSelector string) (*Policy, error) {
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+	for i, r := range p.Rules {
+		if r == nil {
+			return nil, fmt.Errorf("%s: rule %d is empty", fname, i)
+		}
+		r.Source = fname
+		if r.Selector == "" {
+			r.Selector = defaultSelector
+		}
+		if r.Selector == "" {
+			return nil, fmt.Errorf("%s: rule %d has no selector", fname, i)
+		}
+		switch r.Scope {
+		case ScopeAll, ScopeTest, ScopeNonTest:
+		default:
+			return nil, fmt.Errorf("%s: rule %d has unknown scope %q", fname, i, r.Scope)
+		}
+	}
+	return p, nil
+}
+
+// Add appends the rules of other to p
+func (p *Policy) Add(other *Policy) {
+	p.Rules = append(p.Rules, other.Rules...)
+}
+
+// hasPathPrefix tells whether path is prefix or one of its subpackages
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// check returns the reason why rule r rejects import e, or ""
+func (r *Rule) check(e Edge) string {
+	if (r.Scope == ScopeTest && !e.Test) || (r.Scope == ScopeNonTest && e.Test) {
+		return ""
+	}
+	for _, f := range r.ForbiddenPrefixes {
+		if hasPathPrefix(e.To, f) {
+			return fmt.Sprintf("forbidden by %s for %s", f, r.Selector)
+		}
+	}
+	if len(r.AllowedPrefixes) == 0 {
+		return ""
+	}
+	for _, a := range r.AllowedPrefixes {
+		if hasPathPrefix(e.To, a) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("not allowed for %s", r.Selector)
+}
+
+// Check evaluates p against the imports of g, and returns the violations
+// sorted by importing package. dir, if set, returns the directory of a
+// package, and is used to locate offending imports.
+func (p *Policy) Check(g Graph, dir func(pkg string) string) []Violation {
+	res := make([]Violation, 0)
+	positions := make(map[string]map[importKey]token.Position)
+	for _, pkg := range g.packages() {
+		path := g.PackagePath(pkg)
+		for _, r := range p.Rules {
+			if !hasPathPrefix(path, r.Selector) {
+				continue
+			}
+			for _, e := range g.edges(pkg, true) {
+				reason := r.check(e)
+				if reason == "" {
+					continue
+				}
+				v := Violation{
+					Rule:   r,
+					Edge:   e,
+					Reason: reason,
+				}
+				if dir != nil {
+					if _, ok := positions[pkg]; !ok {
+						positions[pkg] = importPositions(dir(path), g[pkg].Kind)
+					}
+					v.Position = positions[pkg][importKey{e.To, e.Test}]
+				}
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+type importKey struct {
+	path string
+	test bool
+}
+
+// importPositions returns the first position of each import of the node of
+// the given kind found in dir. Unlike scanDir, it doesn't filter files: rules
+// apply to all of them.
+func importPositions(dir, kind string) map[importKey]token.Position {
+	res := make(map[importKey]token.Position)
+	if dir == "" {
+		return res
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return res
+	}
+	sort.Strings(names)
+
+	fset := token.NewFileSet()
+	for _, fname := range names {
+		f, err := parser.ParseFile(fset, fname, nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		test := strings.HasSuffix(fname, "_test.go")
+		xtest := test && strings.HasSuffix(f.Name.Name, "_test")
+		main := f.Name.Name == "main" && !xtest
+		switch kind {
+		case KindExternalTest:
+			if !xtest {
+				continue
+			}
+		case KindMain:
+			// commands are main packages, and so are main programs sitting
+			// next to another package
+			if !main {
+				continue
+			}
+		default:
+			if xtest || main {
+				continue
+			}
+		}
+
+		for _, i := range f.Imports {
+			path, err := strconv.Unquote(i.Path.Value)
+			if err != nil {
+				continue
+			}
+			k := importKey{path, test || kind == KindExternalTest}
+			if _, ok := res[k]; !ok {
+				res[k] = fset.Position(i.Pos())
+			}
+		}
+	}
+	return res
+}
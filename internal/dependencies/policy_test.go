@@ -0,0 +1,83 @@
+package dependencies
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"api/core/core.go":      "package core\n\nimport (\n\t\"fmt\"\n\t_ \"k8s.io/kubernetes/pkg\"\n)\n",
+		"api/core/core_test.go": "package core\n\nimport _ \"github.com/stretchr/testify\"\n",
+		"api/core/x_test.go":    "package core_test\n\nimport _ \"k8s.io/kubernetes/test\"\n",
+		"rules.json": `{"Rules": [
+			{"Selector": "k8s.io/api", "ForbiddenPrefixes": ["k8s.io/kubernetes"], "Scope": "nontest"},
+			{"AllowedPrefixes": ["k8s.io/apimachinery", "k8s.io/kubernetes/test"], "Scope": "test"}
+		]}`,
+	} {
+		fname := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		ioutil.WriteFile(fname, []byte(content), 0644)
+	}
+
+	p, err := LoadPolicy(filepath.Join(dir, "rules.json"), "k8s.io/api/core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rules[1].Selector != "k8s.io/api/core" {
+		t.Errorf("expected the default selector, got %s", p.Rules[1].Selector)
+	}
+
+	g := Graph{
+		"k8s.io/api/core":         {Imports: []string{"k8s.io/kubernetes/pkg", "k8s.io/apimachinery"}, TestImports: []string{"github.com/stretchr/testify"}},
+		"k8s.io/api/core [xtest]": {Kind: KindExternalTest, Imports: []string{"k8s.io/kubernetes/test"}},
+		"k8s.io/apiextensions":    {Imports: []string{"k8s.io/kubernetes/pkg"}},
+		"k8s.io/apimachinery/pkg": {Imports: []string{"k8s.io/kubernetes/pkg"}},
+	}
+	violations := p.Check(g, func(pkg string) string {
+		return filepath.Join(dir, "api", "core")
+	})
+
+	expected := []struct {
+		from, to string
+		file     string
+		line     int
+	}{
+		{"k8s.io/api/core", "k8s.io/kubernetes/pkg", "core.go", 5},
+		{"k8s.io/api/core", "github.com/stretchr/testify", "core_test.go", 3},
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %d violations, got %v", len(expected), violations)
+	}
+	for i, e := range expected {
+		v := violations[i]
+		if v.Edge.From != e.from || v.Edge.To != e.to {
+			t.Errorf("expected %s -> %s, got %s", e.from, e.to, v.String())
+		}
+		if filepath.Base(v.Position.Filename) != e.file || v.Position.Line != e.line {
+			t.Errorf("expected %s:%d, got %s", e.file, e.line, v.Position)
+		}
+	}
+
+	for _, content := range []string{
+		`{"Rules": [{"ForbiddenPrefixes": ["x"]}]}`,
+		`{"Rules": [{"Selector": "a", "Scope": "tests"}]}`,
+		`{"Rules": [null]}`,
+		// import-boss rules
+		`{"Rules": [{"SelectorRegexp": "k8s[.]io", "AllowedPrefixes": ["k8s.io/api"]}]}`,
+	} {
+		fname := filepath.Join(dir, "bad.json")
+		ioutil.WriteFile(fname, []byte(content), 0644)
+		if _, err := LoadPolicy(fname, ""); err == nil {
+			t.Errorf("expected an error for %s", content)
+		}
+	}
+}
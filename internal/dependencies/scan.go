@@ -0,0 +1,173 @@
+package dependencies
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Platform is a target operating system and architecture
+type Platform struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (p Platform) String() string {
+	return p.GOOS + "/" + p.GOARCH
+}
+
+// ParsePlatforms parses a comma-separated list of GOOS/GOARCH pairs
+func ParsePlatforms(s string) ([]Platform, error) {
+	res := make([]Platform, 0)
+	for _, p := range strings.Split(s, ",") {
+		if p == "" {
+			continue
+		}
+		parts := strings.Split(p, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid platform %q, expected GOOS/GOARCH", p)
+		}
+		res = append(res, Platform{GOOS: parts[0], GOARCH: parts[1]})
+	}
+	return res, nil
+}
+
+// ScanOptions selects the files whose imports end up in the graph. The zero
+// value scans every .go file.
+type ScanOptions struct {
+	// Context, if set, only keeps the files it matches, as the go command
+	// would: build constraints, file name suffixes and cgo.
+	Context *build.Context
+	// Platforms, if set, scans files once per platform, with the tags and
+	// cgo setting of Context (build.Default if nil), and merges the results.
+	// Imports that don't apply to all platforms are recorded in
+	// Node.Platforms and Node.TestPlatforms.
+	Platforms []Platform
+}
+
+// contexts returns the build contexts to match files against, and their
+// names. No context means that all files are scanned.
+func (o *ScanOptions) contexts() ([]*build.Context, []string) {
+	if o.Context == nil && len(o.Platforms) == 0 {
+		return nil, nil
+	}
+	base := build.Default
+	if o.Context != nil {
+		base = *o.Context
+	}
+	if len(o.Platforms) == 0 {
+		return []*build.Context{&base}, []string{base.GOOS + "/" + base.GOARCH}
+	}
+
+	ctxts := make([]*build.Context, 0, len(o.Platforms))
+	names := make([]string, 0, len(o.Platforms))
+	for _, p := range o.Platforms {
+		c := base
+		c.GOOS, c.GOARCH = p.GOOS, p.GOARCH
+		ctxts = append(ctxts, &c)
+		names = append(names, p.String())
+	}
+	return ctxts, names
+}
+
+// scannedFile is a Go file and its imports. platforms lists the indices of
+// the contexts matching the file, nil meaning all of them. ignored tells
+// whether the file is excluded by the ignore build tag.
+type scannedFile struct {
+	name      string
+	imports   []string
+	platforms []int
+	ignored   bool
+}
+
+// hasIgnoreTag tells whether f is excluded from builds by the ignore build
+// tag, as generators and other programs run with go run typically are
+func hasIgnoreTag(f *ast.File) bool {
+	for _, g := range f.Comments {
+		if g.Pos() >= f.Package {
+			break
+		}
+		for _, c := range g.List {
+			line := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if line == "+build ignore" || line == "go:build ignore" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scanDir returns the files of dir matching at least one of ctxts (or all of
+// them if ctxts is empty), grouped by package name
+func scanDir(dir string, ctxts []*build.Context) (map[string][]*scannedFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	res := make(map[string][]*scannedFile)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+
+		var matching []int
+		for i, c := range ctxts {
+			ok, err := c.MatchFile(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matching = append(matching, i)
+			}
+		}
+		if len(ctxts) > 0 && len(matching) == 0 {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		sf := &scannedFile{
+			name:      name,
+			imports:   make([]string, 0, len(f.Imports)),
+			platforms: matching,
+			ignored:   hasIgnoreTag(f),
+		}
+		cgo := false
+		for _, i := range f.Imports {
+			d := i.Path.Value
+			d = d[1 : len(d)-1] // remove quotes
+			if d == "C" {
+				cgo = true
+			}
+			sf.imports = append(sf.imports, d)
+		}
+
+		if cgo && len(ctxts) > 0 {
+			// cgo files are dropped by contexts that disable it
+			enabled := make([]int, 0, len(matching))
+			for _, i := range matching {
+				if ctxts[i].CgoEnabled {
+					enabled = append(enabled, i)
+				}
+			}
+			if len(enabled) == 0 {
+				continue
+			}
+			sf.platforms = enabled
+		}
+
+		res[f.Name.Name] = append(res[f.Name.Name], sf)
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package dependencies
+
+import (
+	"context"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestScanOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"a.go":         "package a\n\nimport _ \"example.com/common\"\n",
+		"a_linux.go":   "package a\n\nimport _ \"example.com/linux\"\n",
+		"a_windows.go": "package a\n\nimport _ \"example.com/windows\"\n",
+		"cgo.go":       "package a\n\n// #include <stdio.h>\nimport \"C\"\nimport _ \"example.com/cgo\"\n",
+		"gen.go":       "// +build ignore\n\npackage a\n\nimport _ \"example.com/gen\"\n",
+		"a_test.go":    "package a\n\nimport _ \"example.com/test\"\n",
+		// tests importing a platform-specific package on all platforms
+		// don't make it apply to all of them
+		"b_test.go":         "package a\n\nimport _ \"example.com/linux\"\n",
+		"a_windows_test.go": "package a\n\nimport _ \"example.com/wintest\"\n",
+	} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	noCgo := build.Default
+	noCgo.GOOS, noCgo.GOARCH, noCgo.CgoEnabled = "linux", "amd64", false
+	withCgo := noCgo
+	withCgo.CgoEnabled = true
+
+	for _, tc := range []struct {
+		name          string
+		opts          ScanOptions
+		imports       []string
+		testImports   []string
+		platforms     map[string][]string
+		testPlatforms map[string][]string
+	}{
+		{"all files", ScanOptions{}, []string{"example.com/cgo", "example.com/common", "example.com/gen", "example.com/linux", "example.com/windows"}, []string{"example.com/test", "example.com/wintest"}, nil, nil},
+		{"linux without cgo", ScanOptions{Context: &noCgo}, []string{"example.com/common", "example.com/linux"}, []string{"example.com/test"}, nil, nil},
+		{"platforms", ScanOptions{
+			Context:   &withCgo,
+			Platforms: []Platform{{"linux", "amd64"}, {"windows", "amd64"}},
+		}, []string{"example.com/cgo", "example.com/common", "example.com/linux", "example.com/windows"}, []string{"example.com/test", "example.com/wintest"}, map[string][]string{
+			"example.com/linux":   {"linux/amd64"},
+			"example.com/windows": {"windows/amd64"},
+		}, map[string][]string{
+			"example.com/wintest": {"windows/amd64"},
+		}},
+	} {
+		g, err := (&DepsBuilder{
+			Root:    dir,
+			Package: "example.com/a",
+			Scan:    tc.opts,
+		}).GetFullDependencyGraph(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		n := g["example.com/a"]
+		if n == nil {
+			t.Fatalf("%s: package not found in %v", tc.name, g)
+		}
+		imports := append([]string(nil), n.Imports...)
+		sort.Strings(imports)
+		if !reflect.DeepEqual(imports, tc.imports) {
+			t.Errorf("%s: expected imports %v, got %v", tc.name, tc.imports, imports)
+		}
+		testImports := append([]string(nil), n.TestImports...)
+		sort.Strings(testImports)
+		if !reflect.DeepEqual(testImports, tc.testImports) {
+			t.Errorf("%s: expected test imports %v, got %v", tc.name, tc.testImports, testImports)
+		}
+		if !reflect.DeepEqual(n.Platforms, tc.platforms) {
+			t.Errorf("%s: expected platforms %v, got %v", tc.name, tc.platforms, n.Platforms)
+		}
+		if !reflect.DeepEqual(n.TestPlatforms, tc.testPlatforms) {
+			t.Errorf("%s: expected test platforms %v, got %v", tc.name, tc.testPlatforms, n.TestPlatforms)
+		}
+	}
+
+	if _, err := ParsePlatforms("linux/amd64,windows"); err == nil {
+		t.Error("expected an error for an invalid platform")
+	}
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright 2018 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package diff renders line-based unified diffs.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff turning a into b, using the given names in
+// the file headers. It returns nil if both contents are identical.
+func Unified(aName, bName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n", aName)
+	fmt.Fprintf(&buf, "+++ %s\n", bName)
+
+	// aLine and bLine track the 1-based line numbers at position i in ops.
+	aLine, bLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		// Found a change, extend the hunk until there are enough unchanged
+		// lines in a row to close it.
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end += min(contextLines, run-end)
+				break
+			}
+			end = run
+		}
+
+		hunkA, hunkB := aLine-(i-start), bLine-(i-start)
+		var aCount, bCount int
+		var body bytes.Buffer
+		for _, o := range ops[start:end] {
+			switch o.kind {
+			case opEqual:
+				aCount++
+				bCount++
+				body.WriteString(" " + o.line)
+			case opDelete:
+				aCount++
+				body.WriteString("-" + o.line)
+			case opInsert:
+				bCount++
+				body.WriteString("+" + o.line)
+			}
+			if !strings.HasSuffix(o.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunkA, aCount), hunkRange(hunkB, bCount))
+		buf.Write(body.Bytes())
+
+		for _, o := range ops[i:end] {
+			if o.kind != opInsert {
+				aLine++
+			}
+			if o.kind != opDelete {
+				bLine++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// by convention an empty range refers to the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps computes an edit script between a and b. Common prefix and suffix
+// are stripped first so that the LCS computation only deals with the region
+// that actually changed, which is typically tiny for generated files.
+func lineOps(a, b []string) []op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	res := make([]op, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		res = append(res, op{opEqual, l})
+	}
+	res = append(res, lcsOps(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		res = append(res, op{opEqual, l})
+	}
+	return res
+}
+
+// maxLCSCells bounds the number of line comparisons made by lcsOps. Beyond
+// it, the changed region is rendered as a whole replacement.
+const maxLCSCells = 1 << 24
+
+// lcsOps computes an edit script between a and b from their longest common
+// subsequence, using Hirschberg's algorithm so that memory stays linear in
+// the number of lines.
+func lcsOps(a, b []string) []op {
+	res := make([]op, 0, len(a)+len(b))
+	if len(a)*len(b) > maxLCSCells {
+		return replaceOps(res, a, b)
+	}
+	return hirschberg(res, a, b)
+}
+
+func replaceOps(res []op, a, b []string) []op {
+	for _, l := range a {
+		res = append(res, op{opDelete, l})
+	}
+	for _, l := range b {
+		res = append(res, op{opInsert, l})
+	}
+	return res
+}
+
+func hirschberg(res []op, a, b []string) []op {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return replaceOps(res, a, b)
+	case len(a) == 1:
+		for j, l := range b {
+			if l == a[0] {
+				res = replaceOps(res, nil, b[:j])
+				res = append(res, op{opEqual, l})
+				return replaceOps(res, nil, b[j+1:])
+			}
+		}
+		return replaceOps(res, a, b)
+	}
+
+	// split b where the halves of a have the longest common subsequences
+	mid := len(a) / 2
+	fwd := lcsPrefixes(a[:mid], b)
+	bwd := lcsSuffixes(a[mid:], b)
+	k := 0
+	for j := range fwd {
+		if fwd[j]+bwd[j] > fwd[k]+bwd[k] {
+			k = j
+		}
+	}
+	res = hirschberg(res, a[:mid], b[:k])
+	return hirschberg(res, a[mid:], b[k:])
+}
+
+// lcsPrefixes returns the lengths of the longest common subsequences of a
+// and each prefix b[:j].
+func lcsPrefixes(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] >= cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+// lcsSuffixes returns the lengths of the longest common subsequences of a
+// and each suffix b[j:].
+func lcsSuffixes(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				cur[j] = prev[j+1] + 1
+			case prev[j] >= cur[j+1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j+1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnifiedIdentical(t *testing.T) {
+	if d := Unified("a", "b", []byte("foo\n"), []byte("foo\n")); d != nil {
+		t.Errorf("expected no diff, got %q", d)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+	expected := `--- a/f
++++ b/f
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if d := string(Unified("a/f", "b/f", []byte(a), []byte(b))); d != expected {
+		t.Errorf("unexpected diff:\n%s", d)
+	}
+}
+
+func TestUnifiedNewFile(t *testing.T) {
+	expected := `--- /dev/null
++++ b/f
+@@ -0,0 +1,2 @@
++foo
++bar
+\ No newline at end of file
+`
+	if d := string(Unified("/dev/null", "b/f", nil, []byte("foo\nbar"))); d != expected {
+		t.Errorf("unexpected diff:\n%s", d)
+	}
+}
+
+// apply rebuilds both sides of an edit script
+func apply(ops []op) (string, string) {
+	var a, b string
+	for _, o := range ops {
+		if o.kind != opInsert {
+			a += o.line
+		}
+		if o.kind != opDelete {
+			b += o.line
+		}
+	}
+	return a, b
+}
+
+func TestLineOps(t *testing.T) {
+	for _, tc := range []struct {
+		a, b  string
+		equal int
+	}{
+		{"a\nb\nc\nd\n", "a\nx\nc\ny\n", 2},
+		{"a\nb\nc\n", "c\nb\na\n", 1},
+		{"x\na\nb\ny\nc\nd\n", "a\nz\nb\nc\nw\nd\n", 4},
+		{"a\nb\n", "", 0},
+	} {
+		ops := lineOps(splitLines([]byte(tc.a)), splitLines([]byte(tc.b)))
+		if a, b := apply(ops); a != tc.a || b != tc.b {
+			t.Errorf("%q -> %q: script rebuilds %q -> %q", tc.a, tc.b, a, b)
+		}
+		equal := 0
+		for _, o := range ops {
+			if o.kind == opEqual {
+				equal++
+			}
+		}
+		if equal != tc.equal {
+			t.Errorf("%q -> %q: expected %d unchanged lines, got %d", tc.a, tc.b, tc.equal, equal)
+		}
+	}
+}
+
+func TestLineOpsTooLarge(t *testing.T) {
+	a := make([]string, 0)
+	b := make([]string, 0)
+	for i := 0; i*i <= maxLCSCells; i++ {
+		a = append(a, fmt.Sprintf("a%d\n", i))
+		b = append(b, fmt.Sprintf("b%d\n", i))
+	}
+	b[len(b)/2] = a[len(a)/2]
+
+	// beyond the limit, the changed region is replaced as a whole
+	ops := lcsOps(a, b)
+	if len(ops) != len(a)+len(b) || ops[0].kind != opDelete || ops[len(ops)-1].kind != opInsert {
+		t.Errorf("expected a whole replacement")
+	}
+}
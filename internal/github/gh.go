@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
 	"time"
@@ -30,33 +31,39 @@ type Commit struct {
 }
 
 // GithubCommit returns a Commit object
-func (h *RefHelper) GithubCommit(repo, commit string) *Commit {
+func (h *RefHelper) GithubCommit(ctx context.Context, repo, commit string) (*Commit, error) {
 	r, err := repoToGithub(repo)
 	if err != nil {
-		fmt.Println("failed for", repo)
-		return &Commit{}
+		return nil, fmt.Errorf("%s: %v", repo, err)
 	}
 
 	cpts := strings.Split(r, "/")
 	owner := cpts[1]
-	repo = cpts[2]
+	name := cpts[2]
 
 	svc := h.client.Git
-	ctx := context.Background()
-	c, _, err := svc.GetCommit(ctx, owner, repo, commit)
-
+	c, _, err := svc.GetCommit(ctx, owner, name, commit)
 	if err != nil {
-		panic(err)
-		return &Commit{
-			ID: commit,
-		}
+		return nil, fmt.Errorf("%s@%s: %v", repo, commit, err)
 	}
 
-	fmt.Println("got date for", repo)
+	log.Println("got date for", repo)
 	return &Commit{
 		ID:   commit,
 		Date: c.Committer.Date,
+	}, nil
+}
+
+// CommitTime returns the commit date of a revision of repo
+func (h *RefHelper) CommitTime(ctx context.Context, repo, rev string) (time.Time, error) {
+	c, err := h.GithubCommit(ctx, repo, rev)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if c.Date == nil {
+		return time.Time{}, fmt.Errorf("no commit date for %s@%s", repo, rev)
 	}
+	return *c.Date, nil
 }
 
 func (c *Commit) VgoTimestamp() string {
@@ -66,6 +73,16 @@ func (c *Commit) VgoTimestamp() string {
 	return c.Date.Format("20060102150405")
 }
 
+// CompareURL returns the URL of the Github page comparing two revisions of
+// repo
+func CompareURL(repo, from, to string) (string, error) {
+	r, err := repoToGithub(repo)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s/compare/%s...%s", r, from, to), nil
+}
+
 // TODO(yhodique) make it more subtle...
 func repoToGithub(repo string) (string, error) {
 	known := map[string]string{
@@ -2,26 +2,18 @@ package init
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
-	"github.com/blang/semver"
 	"github.com/sigma/vgo-k8s-tools/internal/convert"
+	"github.com/sigma/vgo-k8s-tools/internal/github"
 )
 
-var (
-	cache map[string]string
-)
-
-func init() {
-	cache = make(map[string]string)
-}
-
 type Replacement struct {
 	ModuleName string
 	Path       string
@@ -43,6 +35,14 @@ type Converter struct {
 	RootDir       string
 	ModuleName    string
 	StagingSubdir string
+	// Output receives the generated files. Defaults to writing them in
+	// place.
+	Output convert.Output
+	// Importer resolves the versions of the dependencies found in Godeps
+	// files. Defaults to querying the module proxy of the environment, and
+	// Github for commit dates. Locally replaced modules are added to its
+	// Local modules.
+	Importer *convert.GodepsImporter
 }
 
 func NewConverter(root, mod string) *Converter {
@@ -84,158 +84,92 @@ func (c *Converter) GetReplacements() []*Replacement {
 	return res
 }
 
-func (c *Converter) GenGoMods() error {
+func (c *Converter) GenGoMods(ctx context.Context) error {
 	replacements := c.GetReplacements()
-
-	writers := make([]*GoModWriter, 0)
+	im := c.importer()
+	for _, r := range replacements {
+		im.Local = append(im.Local, r.ModuleName)
+	}
 
 	abs, _ := filepath.Abs(c.RootDir)
-	writers = append(writers, &GoModWriter{
+	writers := []*GoModWriter{{
 		RootDir:      abs,
 		ModuleName:   c.ModuleName,
 		Replacements: replacements,
-		Requirements: getRequirements(abs),
-	})
-
+	}}
 	for _, r := range replacements {
 		writers = append(writers, &GoModWriter{
 			RootDir:      r.Path,
 			ModuleName:   r.ModuleName,
 			Replacements: replacements,
-			Requirements: getRequirements(r.Path),
 		})
 	}
 
 	for _, w := range writers {
-		err := w.Write()
+		reqs, err := c.getRequirements(ctx, w.RootDir)
 		if err != nil {
 			return err
 		}
+		w.Requirements = reqs
 	}
-	return nil
-}
 
-// ouch, that's horrible. But hey, that's just a transition tool. We'll stop
-// needing it when k8s uses vgo for real.
-func guessRepo(path string) (string, string, error) {
-	pack := "."
-	if strings.HasPrefix(path, "github.com") ||
-		strings.HasPrefix(path, "golang.org") ||
-		strings.HasPrefix(path, "bitbucket.org") ||
-		strings.HasPrefix(path, "gonum.org") {
-		cpts := strings.SplitN(path, "/", 4)
-		if len(cpts) > 3 {
-			pack = cpts[3]
-		}
-		return strings.Join(cpts[:3], "/"), pack, nil
-	}
-	if strings.HasPrefix(path, "cloud.google.com") ||
-		strings.HasPrefix(path, "google.golang.org") ||
-		strings.HasPrefix(path, "k8s.io") ||
-		strings.HasPrefix(path, "vbom.ml") {
-		cpts := strings.SplitN(path, "/", 3)
-		if len(cpts) > 2 {
-			pack = cpts[2]
-		}
-		return strings.Join(cpts[:2], "/"), pack, nil
-	}
-	if strings.HasPrefix(path, "go4.org") {
-		cpts := strings.SplitN(path, "/", 2)
-		if len(cpts) > 1 {
-			pack = cpts[1]
-		}
-		return strings.Join(cpts[:1], "/"), pack, nil
-	}
-	if strings.HasPrefix(path, "gopkg.in") {
-		r := regexp.MustCompile(`(?P<Repo>.*\.v[0-9]*)(?:/(?P<Path>.*))?`)
-		cpts := r.FindStringSubmatch(path)
-
-		if len(cpts) < 3 {
-			return path, ".", fmt.Errorf("not a valid gopkg.in repo")
-		}
-		if cpts[2] != "" {
-			pack = cpts[2]
+	out := c.output()
+	for _, w := range writers {
+		err := out.WriteFile(filepath.Join(w.RootDir, "go.mod"), w.Render())
+		if err != nil {
+			return err
 		}
-		return cpts[1], pack, nil
 	}
-
-	return path, ".", fmt.Errorf("don't know how to guess %s", path)
+	return nil
 }
 
-func getRequirements(path string) []*Requirement {
-	fname := filepath.Join(path, "Godeps", "Godeps.json")
-	content, err := ioutil.ReadFile(fname)
-
-	if err != nil {
-		return nil
+func (c *Converter) output() convert.Output {
+	if c.Output != nil {
+		return c.Output
 	}
+	return &convert.DiskOutput{}
+}
 
-	var doc convert.Godeps
-	json.Unmarshal(content, &doc)
-
-	repos := make(map[string]string)
-	for _, d := range doc.Deps {
-		if strings.HasPrefix(d.Rev, "xxxxxxxxxx") {
-			continue
-		}
-		r, _, err := guessRepo(d.ImportPath)
-		if err != nil {
-			panic(d.ImportPath)
-		}
-
-		if e, ok := cache[r]; ok {
-			repos[r] = e
-			continue
-		}
-
-		maj := "v0"
-		if strings.HasPrefix(r, "gopkg.in") {
-			maj = r[strings.LastIndex(r, ".")+1:]
-		}
-		repos[r] = fmt.Sprintf("%s.0.0-00000000000000-%s", maj, d.Rev[:12])
-
-		if d.Comment != "" && isSupportedVgoVersion(d.Comment) {
-			repos[r] = d.Comment
+func (c *Converter) importer() *convert.GodepsImporter {
+	if c.Importer == nil {
+		c.Importer = &convert.GodepsImporter{
+			Proxy: convert.NewHashResolver().Proxy,
+			Dater: github.NewRefHelper(),
 		}
-
-		cache[r] = repos[r]
 	}
-
-	res := make([]*Requirement, 0)
-	for k, v := range repos {
-		res = append(res, &Requirement{
-			ModuleName: k,
-			Version:    v,
-		})
-	}
-	return res
+	return c.Importer
 }
 
-func isSupportedVgoVersion(version string) bool {
-	numVersion := version
-	// TODO(yhodique) vgo seems a bit overzealous right there
-	if !strings.HasPrefix(version, "v") {
-		return false
+// getRequirements resolves the dependencies recorded in the Godeps file of
+// the module in path, but those on locally replaced modules, which are Local
+// modules of the importer
+func (c *Converter) getRequirements(ctx context.Context, path string) ([]*Requirement, error) {
+	gd, err := convert.LoadGodeps(filepath.Join(path, "Godeps", "Godeps.json"))
+	if err != nil || gd == nil {
+		return nil, err
 	}
-	numVersion = version[1:]
 
-	if strings.Contains(numVersion, "-g") { // git pseudo-version
-		return false
-	}
-
-	v, err := semver.Make(numVersion)
+	mods, err := c.importer().Requirements(ctx, gd)
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
 
-	if v.Major >= 2 {
-		return false
+	res := make([]*Requirement, 0, len(mods))
+	for _, m := range mods {
+		res = append(res, &Requirement{
+			ModuleName: m.Path,
+			Version:    m.Version,
+		})
 	}
-
-	return true
+	return res, nil
 }
 
 func (g *GoModWriter) Write() error {
+	return ioutil.WriteFile(filepath.Join(g.RootDir, "go.mod"), g.Render(), 0644)
+}
+
+// Render returns the content of the go.mod file
+func (g *GoModWriter) Render() []byte {
 	var b bytes.Buffer
 	fmt.Fprintln(&b, "module", g.ModuleName)
 	fmt.Fprintln(&b, "require (")
@@ -265,7 +199,7 @@ func (g *GoModWriter) Write() error {
 	}
 	fmt.Fprintln(&b, ")")
 
-	return ioutil.WriteFile(filepath.Join(g.RootDir, "go.mod"), b.Bytes(), 0644)
+	return b.Bytes()
 }
 
 func (c *Converter) GenVendorGo() error {
@@ -289,5 +223,5 @@ func (c *Converter) GenVendorGo() error {
 	}
 	fmt.Fprintln(&b, ")")
 
-	return ioutil.WriteFile(filepath.Join(path, "vendor.go"), b.Bytes(), 0644)
+	return c.output().WriteFile(filepath.Join(path, "vendor.go"), b.Bytes())
 }
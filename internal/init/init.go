@@ -1,9 +1,55 @@
 package init
 
-import "os"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sigma/vgo-k8s-tools/internal/convert"
+)
 
 func Main() {
-	c := NewConverter(".", os.Args[1])
-	c.GenGoMods()
-	c.GenVendorGo()
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] <module>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	verify := fs.Bool("verify", false, "fail if any generated file differs from its current version, without writing anything")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := NewConverter(".", fs.Arg(0))
+	var check *convert.CheckOutput
+	if *verify {
+		check = &convert.CheckOutput{}
+		c.Output = check
+	}
+
+	err := c.GenGoMods(context.Background())
+	if err == nil {
+		err = c.GenVendorGo()
+		// vendor.go is only generated from an existing Godeps file, unless
+		// verifying
+		if os.IsNotExist(err) && !*verify {
+			err = nil
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if check != nil && len(check.Stale) > 0 {
+		fmt.Fprintln(os.Stderr, "generated files are out of date:")
+		for _, f := range check.Stale {
+			fmt.Fprintln(os.Stderr, "\t"+f)
+		}
+		os.Exit(1)
+	}
 }